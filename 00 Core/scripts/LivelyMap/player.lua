@@ -116,6 +116,7 @@ local fromSave = {
 ---@field y number? Exterior world position component.
 ---@field z number? Exterior world position component.
 ---@field c string? Interior cell ID.
+---@field j boolean? Set by the sync tool on the first entry after a teleport or trip.
 
 ---@class SavedPlayerData
 ---@field id string
@@ -232,7 +233,9 @@ local function addEntry(entry)
         return
     end
     local tail = allData[playerName].paths[#(allData[playerName].paths)]
-    if tail.x and tail.y then
+    -- always keep going in or out of an interior, so the Go side
+    -- can tell where interior visits are.
+    if tail.x and tail.y and tail.c == entry.c then
         -- also don't do anything if the distance is too close
         -- 7456540 is a third of cell length, squared
         if (util.vector2(entry.x, entry.y) - util.vector2(tail.x, tail.y)):length2() < 7456540 then
@@ -263,12 +266,18 @@ local function onReceiveExteriorLocation(data)
         pos = util.vector3(data.pos.x, data.pos.y, data.pos.z),
         facing = util.vector2(data.facing.x, data.facing.y),
     }
-    addEntry({
+    local entry = {
         t = math.ceil(core.getGameTime()),
         x = data.pos.x,
         y = data.pos.y,
         z = data.pos.z,
-    })
+    }
+    -- interior visits are recorded at the exterior position they
+    -- were entered from.
+    if not pself.cell.isExterior then
+        entry.c = pself.cell.id
+    end
+    addEntry(entry)
 end
 
 
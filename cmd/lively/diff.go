@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/erinpentecost/LivelyMap/internal/hdmap"
+	"github.com/ernmw/omwpacker/cfg"
+)
+
+func init() {
+	commands["diff"] = &command{
+		usage: "diff -old=<cfg or list> -new=<cfg or list> [flags]\n\tcompare the landmass of two load orders",
+		run:   diff,
+	}
+}
+
+// loadOrder loads either an openmw.cfg, or a plain text file with one
+// plugin per line. Plugins in a list are found in the data folders of
+// base, unless they are full paths.
+func loadOrder(base *cfg.Environment, path string) (*cfg.Environment, error) {
+	if strings.EqualFold(filepath.Ext(path), ".cfg") {
+		env, _, err := loadEnv(path)
+		return env, err
+	}
+	if base == nil {
+		return nil, fmt.Errorf("a base openmw.cfg is needed to resolve plugin list %q", path)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open plugin list %q: %w", path, err)
+	}
+	defer f.Close()
+
+	env := &cfg.Environment{
+		Path:  base.Path,
+		BSA:   base.BSA,
+		Data:  base.Data,
+		User:  base.User,
+		Local: base.Local,
+	}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		name := strings.TrimSpace(scanner.Text())
+		name = strings.TrimSpace(strings.TrimPrefix(name, "content="))
+		if len(name) == 0 || strings.HasPrefix(name, "#") {
+			continue
+		}
+		plugin, err := findPlugin(base, name)
+		if err != nil {
+			return nil, err
+		}
+		env.Plugins = append(env.Plugins, plugin)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read plugin list %q: %w", path, err)
+	}
+	return env, nil
+}
+
+// findPlugin resolves a plugin name against the data folders,
+// later folders first.
+func findPlugin(env *cfg.Environment, name string) (string, error) {
+	if filepath.IsAbs(name) {
+		return name, nil
+	}
+	for i := len(env.Data) - 1; i >= 0; i-- {
+		entries, err := os.ReadDir(env.Data[i])
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			if strings.EqualFold(entry.Name(), name) {
+				return filepath.Join(env.Data[i], entry.Name()), nil
+			}
+		}
+	}
+	return "", fmt.Errorf("can't find plugin %q in any data folder", name)
+}
+
+func diff(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("diff", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to an openmw.cfg file, used to find plugins in plugin lists")
+	oldPath := fs.String("old", "", "the old load order: an openmw.cfg file, or a text file with one plugin per line")
+	newPath := fs.String("new", "", "the new load order: an openmw.cfg file, or a text file with one plugin per line")
+	reportPath := fs.String("report", "diff.json", "where to write the summary of changed cells")
+	texturePath := fs.String("texture", "diff.png", "where to write the diff image. leave empty to skip it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if len(*oldPath) == 0 || len(*newPath) == 0 {
+		return fmt.Errorf("both -old and -new are required")
+	}
+
+	base, _, err := loadEnv(*cfgPath)
+	if err != nil {
+		fmt.Printf("No base openmw.cfg: %v\n", err)
+		base = nil
+	}
+	oldEnv, err := loadOrder(base, *oldPath)
+	if err != nil {
+		return fmt.Errorf("load old load order: %w", err)
+	}
+	newEnv, err := loadOrder(base, *newPath)
+	if err != nil {
+		return fmt.Errorf("load new load order: %w", err)
+	}
+
+	result, err := hdmap.DiffLoadOrders(ctx, oldEnv, newEnv, hdmap.DiffOptions{
+		ReportPath:  *reportPath,
+		TexturePath: *texturePath,
+	})
+	if err != nil {
+		return fmt.Errorf("diff load orders: %w", err)
+	}
+	for _, cell := range result.Cells {
+		switch {
+		case cell.Added:
+			fmt.Printf("+ %d,%d (%s)\n", cell.X, cell.Y, cell.NewPlugin)
+		case cell.Removed:
+			fmt.Printf("- %d,%d (%s)\n", cell.X, cell.Y, cell.OldPlugin)
+		}
+	}
+	fmt.Printf("Summary: %d cells added, %d removed, %d changed.\n", result.Added, result.Removed, result.Changed)
+	return nil
+}
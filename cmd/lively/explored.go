@@ -0,0 +1,41 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["explored"] = &command{
+		usage: "explored [flags]\n\texport the explored areas of OpenMW's global map from each character's newest save",
+		run:   explored,
+	}
+}
+
+func explored(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("explored", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	pixels := fs.Int("pixels", savefile.DefaultExploredPixels, "pixels along the edge of each cell in the masks")
+	paths := fs.Bool("paths", true, "also mark the cells in each character's path file as explored")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *pixels <= 0 {
+		return fmt.Errorf("-pixels must be positive")
+	}
+
+	env, rootPath, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if err := savefile.ExportExplored(rootPath, env, savefile.ExploredOptions{
+		PixelsPerCell: *pixels,
+		Paths:         *paths,
+	}); err != nil {
+		return fmt.Errorf("export explored areas: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["extract-paths"] = &command{
+		usage: "extract-paths [flags]\n\tmove path data out of each character's newest save, or all of their saves with -allsaves, and into their path file",
+		run:   extractPaths,
+	}
+}
+
+func extractPaths(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("extract-paths", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	dryRun := fs.Bool("dry-run", false, "report what would be extracted without changing any save or path file")
+	keep := fs.Int("backups", savefile.DefaultBackups, "number of timestamped backups to keep of each save that paths are extracted from")
+	allSaves := fs.Bool("allsaves", false, "extract paths from all of each character's saves, not just the newest one")
+	branches := fs.Bool("branches", false, "archive the paths of older saves that split off from the newest save's timeline, so they can be extracted too")
+	minDistance := fs.Float64("mindistance", 0, "drop entries this close, in world units, to the last one kept")
+	tolerance := fs.Float64("tolerance", 0, "simplify paths so they stray at most this far, in world units, from the original")
+	minGap := fs.Uint64("mingap", 0, "drop entries less than this many game seconds after the last one kept")
+	grace := fs.Duration("grace", savefile.DefaultGrace, "don't extract paths from saves written less than this long ago")
+	wait := fs.Duration("wait", 0, "how long to wait for OpenMW to close, or for a new save's grace window to pass, before skipping saves")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	env, rootPath, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	reports, err := savefile.ExtractSaveData(rootPath, env, savefile.ExtractOptions{
+		Backups:  *keep,
+		DryRun:   *dryRun,
+		AllSaves: *allSaves,
+		Branches: *branches,
+		Simplify: savefile.SimplifyOptions{
+			MinDistance: *minDistance,
+			Tolerance:   *tolerance,
+			MinTimeGap:  *minGap,
+		},
+		Grace: *grace,
+		Wait:  *wait,
+	})
+	if err != nil {
+		return fmt.Errorf("extract save data: %w", err)
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run. Nothing was changed.")
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "CHARACTER\tSAVES\tADDED\tDROPPED\tSIMPLIFIED\tENTRIES\tBRANCHES\tFIRST\tLAST\tJSON BYTES\tSAVE BYTES REMOVED")
+	for _, r := range reports {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\t%d\n",
+			r.Character, r.Saves, r.Added, r.Dropped, r.Simplified, r.Entries, r.Branches, r.FirstTime, r.LastTime, r.JSONBytes, r.SaveBytesRemoved)
+	}
+	return w.Flush()
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["inject-paths"] = &command{
+		usage: "inject-paths [flags] <save file>\n\tput a character's extracted path data back into a save",
+		run:   injectPaths,
+	}
+}
+
+func injectPaths(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("inject-paths", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	pathFile := fs.String("paths", "", "path file to inject (default the path file of the character the save belongs to)")
+	from := fs.Uint64("from", 0, "only inject entries from this game time on")
+	to := fs.Uint64("to", 0, "only inject entries up to this game time. 0 has no end")
+	keep := fs.Int("backups", savefile.DefaultBackups, "number of timestamped backups to keep of the save")
+	grace := fs.Duration("grace", savefile.DefaultGrace, "don't inject paths into a save written less than this long ago")
+	wait := fs.Duration("wait", 0, "how long to wait for OpenMW to close, or for the save's grace window to pass, before giving up")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one save file, got %d", fs.NArg())
+	}
+	savePath := fs.Arg(0)
+
+	if len(*pathFile) == 0 {
+		_, rootPath, err := loadEnv(*cfgPath)
+		if err != nil {
+			return err
+		}
+		// Saves are in a folder named for the character.
+		character := filepath.Base(filepath.Dir(savePath))
+		*pathFile = filepath.Join(rootPath, savefile.PathsDir, character+".json")
+	}
+	raw, err := os.ReadFile(*pathFile)
+	if err != nil {
+		return fmt.Errorf("read path file: %w", err)
+	}
+	data, err := savefile.Unmarshal(raw)
+	if err != nil {
+		return fmt.Errorf("bad path data in %q: %w", *pathFile, err)
+	}
+
+	injected, err := savefile.InjectData(savePath, savefile.Trim(data, *from, *to), savefile.InjectOptions{
+		Backups: *keep,
+		Grace:   *grace,
+		Wait:    *wait,
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Injected %d path entries from %q into %q.\n", len(injected.Paths), *pathFile, savePath)
+	return nil
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/erinpentecost/LivelyMap/internal/hdmap"
+)
+
+func init() {
+	commands["inspect"] = &command{
+		usage: "inspect cells [flags]\n\treport which plugin defined each cell's landscape",
+		run:   inspect,
+	}
+}
+
+func inspect(ctx context.Context, args []string) error {
+	if len(args) == 0 || args[0] != "cells" {
+		return fmt.Errorf("expected \"inspect cells\"")
+	}
+
+	fs := flag.NewFlagSet("inspect cells", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	format := fs.String("format", "json", "report format, one of: json,csv")
+	outPath := fs.String("out", "", "report file (default cells.json or cells.csv)")
+	texturePath := fs.String("texture", "", "if set, write a png of cells colored by plugin to this path")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if len(*outPath) == 0 {
+		*outPath = "cells." + *format
+	}
+
+	env, _, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+
+	out, err := os.Create(*outPath)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", *outPath, err)
+	}
+	defer out.Close()
+
+	if err := hdmap.InspectCells(ctx, env, hdmap.InspectOptions{
+		Format:      *format,
+		Output:      out,
+		TexturePath: *texturePath,
+	}); err != nil {
+		return fmt.Errorf("inspect cells: %w", err)
+	}
+	fmt.Printf("Wrote cell report to %q.\n", *outPath)
+	return nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["journeys"] = &command{
+		usage: "journeys [flags] <character>\n\texport a character's paths as GeoJSON and GPX for GIS tools",
+		run:   journeys,
+	}
+}
+
+func journeys(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("journeys", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	geojsonPath := fs.String("geojson", "", "GeoJSON output file (default <character>.geojson)")
+	gpxPath := fs.String("gpx", "", "GPX output file (default <character>.gpx)")
+	worldUnits := fs.Bool("worldunits", false, "write GeoJSON in world units instead of longitude and latitude")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one character, got %d", fs.NArg())
+	}
+	character := fs.Arg(0)
+	if len(*geojsonPath) == 0 {
+		*geojsonPath = character + ".geojson"
+	}
+	if len(*gpxPath) == 0 {
+		*gpxPath = character + ".gpx"
+	}
+
+	_, rootPath, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	data, err := savefile.ReadPathFile(rootPath, character)
+	if err != nil {
+		return err
+	}
+
+	if err := savefile.JourneysGeoJSON(data, *worldUnits).Write(*geojsonPath); err != nil {
+		return err
+	}
+	file, err := os.Create(*gpxPath)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", *gpxPath, err)
+	}
+	defer file.Close()
+	if err := savefile.WriteGPX(file, data); err != nil {
+		return fmt.Errorf("write %q: %w", *gpxPath, err)
+	}
+	fmt.Printf("Wrote %q and %q.\n", *geojsonPath, *gpxPath)
+	return nil
+}
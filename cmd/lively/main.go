@@ -6,6 +6,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"sort"
 	"strings"
 	"syscall"
 
@@ -24,51 +25,170 @@ var mapTextures = flag.Bool("maps", true, "create map textures")
 var saveFiles = flag.Bool("saves", true, "extract paths from save files")
 var vanity = flag.Bool("vanity", false, "generate full vanity map")
 var rampPath = flag.String("ramp", "classic", "full path to a ramp file, or one of: classic,gold,light,purple")
+var seams = flag.Bool("seams", false, "report height and normal mismatches between neighboring cells to seams.json")
+var blendSeams = flag.Bool("blendseams", false, "smooth over height and normal mismatches between neighboring cells")
+var regions = flag.Bool("regions", false, "render a region overlay for each submap, and a region-tinted vanity map if -vanity is set")
+var travel = flag.Bool("travel", false, "render a travel route overlay for each submap")
+var footprints = flag.String("footprints", "", "render building, road, wall, and dock footprints for the detail map. this is a rules file, or \"default\" for the built-in rules")
+var biomeRules = flag.String("biomerules", "default", "rules file that sorts land textures into biomes, or \"default\" for the built-in rules")
+var biomes = flag.Bool("biomes", false, "render a biome map for each submap")
+var water = flag.Bool("water", false, "tint lakes and rivers on the classic and detail maps, and give them their own specular strength")
+var roads = flag.String("roads", "", "draw roads found from land textures over the classic and detail maps, and export them to roads.geojson. this is a regular expression for road texture IDs and paths, or \"default\" for the built-in one")
+var tiles = flag.Bool("tiles", false, "write the classic and detail maps as png slippy map tiles for browsing in Leaflet")
+var backups = flag.Int("backups", savefile.DefaultBackups, "number of timestamped backups to keep of each save that paths are extracted from")
+var allSaves = flag.Bool("allsaves", false, "extract paths from all of each character's saves, not just the newest one")
+var branches = flag.Bool("branches", false, "archive the paths of older saves that split off from the newest save's timeline, so they can be extracted too")
+var pathMinDistance = flag.Float64("pathmindistance", 0, "when extracting paths, drop entries this close, in world units, to the last one kept")
+var pathTolerance = flag.Float64("pathtolerance", 0, "when extracting paths, simplify them so they stray at most this far, in world units, from the original")
+var pathMinGap = flag.Uint64("pathmingap", 0, "when extracting paths, drop entries less than this many game seconds after the last one kept")
+var exploredMasks = flag.Bool("explored", false, "export each character's explored areas from the global map in their newest save, merged with their paths")
+var grace = flag.Duration("grace", savefile.DefaultGrace, "don't extract paths from saves written less than this long ago")
+var wait = flag.Duration("wait", 0, "how long to wait for OpenMW to close, or for a new save's grace window to pass, before skipping saves")
+var shelf = flag.Float64("shelf", 1, "distance, in cells, over which missing cells slope from the coast down to the sea floor")
 
-func init() {
-	flag.Parse()
+// command is a subcommand of lively.
+// Running lively without one does a full sync.
+type command struct {
+	usage string
+	run   func(ctx context.Context, args []string) error
+}
+
+var commands = map[string]*command{}
+
+func printFlags() {
 	fmt.Printf("cfg: %q\n", *openmwCfgPath)
 	fmt.Printf("threads: %d\n", *threads)
 	fmt.Printf("maps: %v\n", *mapTextures)
 	fmt.Printf("saveFiles: %v\n", *saveFiles)
 	fmt.Printf("vanity: %v\n", *vanity)
 	fmt.Printf("rampPath: %q\n", *rampPath)
+	fmt.Printf("shelf: %v\n", *shelf)
+	fmt.Printf("seams: %v\n", *seams)
+	fmt.Printf("blendSeams: %v\n", *blendSeams)
+	fmt.Printf("regions: %v\n", *regions)
+	fmt.Printf("travel: %v\n", *travel)
+	fmt.Printf("footprints: %q\n", *footprints)
+	fmt.Printf("biomeRules: %q\n", *biomeRules)
+	fmt.Printf("biomes: %v\n", *biomes)
+	fmt.Printf("roads: %q\n", *roads)
+	fmt.Printf("water: %v\n", *water)
+	fmt.Printf("tiles: %v\n", *tiles)
+	fmt.Printf("backups: %d\n", *backups)
+	fmt.Printf("allSaves: %v\n", *allSaves)
+	fmt.Printf("branches: %v\n", *branches)
+	fmt.Printf("pathMinDistance: %v\n", *pathMinDistance)
+	fmt.Printf("pathTolerance: %v\n", *pathTolerance)
+	fmt.Printf("pathMinGap: %d\n", *pathMinGap)
+	fmt.Printf("explored: %v\n", *exploredMasks)
+	fmt.Printf("grace: %s\n", *grace)
+	fmt.Printf("wait: %s\n", *wait)
 }
 
-func sync(ctx context.Context) error {
-	path := *openmwCfgPath
-	env, err := cfg.Load(path)
+// loadEnv reads openmw.cfg and finds the LivelyMap install.
+func loadEnv(path string) (env *cfg.Environment, rootPath string, err error) {
+	env, err = cfg.Load(path)
 	if err != nil {
-		return fmt.Errorf("load openmw.cfg: %w", err)
+		return nil, "", fmt.Errorf("load openmw.cfg: %w", err)
 	}
-
-	var rootPath string
 	for _, plugin := range env.Plugins {
 		if strings.EqualFold(filepath.Base(plugin), plugin_name) {
 			rootPath = filepath.Dir(filepath.Dir(plugin))
 		}
 	}
+	return env, rootPath, nil
+}
+
+func sync(ctx context.Context) error {
+	env, rootPath, err := loadEnv(*openmwCfgPath)
+	if err != nil {
+		return err
+	}
 
 	if *mapTextures {
-		if err := hdmap.DrawMaps(ctx, rootPath, env, *threads, *vanity, *rampPath); err != nil {
+		if err := hdmap.DrawMaps(ctx, rootPath, env, hdmap.DrawOptions{
+			Threads:        *threads,
+			Vanity:         *vanity,
+			RampPath:       *rampPath,
+			ShelfDistance:  *shelf,
+			SeamReport:     *seams,
+			BlendSeams:     *blendSeams,
+			Regions:        *regions,
+			Travel:         *travel,
+			FootprintRules: *footprints,
+			BiomeRules:     *biomeRules,
+			Biomes:         *biomes,
+			RoadPattern:    *roads,
+			Water:          *water,
+			Tiles:          *tiles,
+		}); err != nil {
 			return fmt.Errorf("draw maps: %w", err)
 		}
 	}
 
 	if *saveFiles {
-		if err := savefile.ExtractSaveData(rootPath, env); err != nil {
+		if _, err := savefile.ExtractSaveData(rootPath, env, savefile.ExtractOptions{
+			Backups:  *backups,
+			AllSaves: *allSaves,
+			Branches: *branches,
+			Simplify: savefile.SimplifyOptions{
+				MinDistance: *pathMinDistance,
+				Tolerance:   *pathTolerance,
+				MinTimeGap:  *pathMinGap,
+			},
+			Grace: *grace,
+			Wait:  *wait,
+		}); err != nil {
 			return fmt.Errorf("extract save data: %w", err)
 		}
 	}
 
+	if *exploredMasks {
+		if err := savefile.ExportExplored(rootPath, env, savefile.ExploredOptions{
+			PixelsPerCell: savefile.DefaultExploredPixels,
+			Paths:         true,
+		}); err != nil {
+			return fmt.Errorf("export explored areas: %w", err)
+		}
+	}
+
 	return nil
 }
 
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintf(out, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(out, "  %s [flags]\n\tsync map textures and save data\n", filepath.Base(os.Args[0]))
+	names := []string{}
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Fprintf(out, "  %s %s\n", filepath.Base(os.Args[0]), commands[name].usage)
+	}
+	fmt.Fprintf(out, "Flags:\n")
+	flag.PrintDefaults()
+}
+
 func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill, syscall.SIGTERM)
 	defer cancel()
 
-	if err := sync(ctx); err != nil {
+	var cmd *command
+	if len(os.Args) > 1 {
+		cmd = commands[os.Args[1]]
+	}
+
+	var err error
+	if cmd != nil {
+		err = cmd.run(ctx, os.Args[2:])
+	} else {
+		flag.Usage = usage
+		flag.Parse()
+		printFlags()
+		err = sync(ctx)
+	}
+	if err != nil {
 		fmt.Printf("FAILED: %v\n", err)
 		os.Exit(33)
 	}
@@ -0,0 +1,48 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["restore"] = &command{
+		usage: "restore [flags] <save file>\n\tput back a save from one of the backups made when extracting paths",
+		run:   restore,
+	}
+}
+
+func restore(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	backupPath := fs.String("backup", "", "the backup to restore (default the newest one)")
+	list := fs.Bool("list", false, "list the backups of the save instead of restoring one")
+	keep := fs.Int("backups", savefile.DefaultBackups, "number of backups to keep of the save, including one of the save before it's restored")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one save file, got %d", fs.NArg())
+	}
+	savePath := fs.Arg(0)
+
+	if *list {
+		backups, err := savefile.Backups(savePath)
+		if err != nil {
+			return err
+		}
+		for _, backup := range backups {
+			fmt.Println(backup)
+		}
+		return nil
+	}
+
+	restored, err := savefile.Restore(savePath, *backupPath, *keep)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Restored %q from %q.\n", savePath, restored)
+	return nil
+}
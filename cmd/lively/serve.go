@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/erinpentecost/LivelyMap/internal/preview"
+)
+
+func init() {
+	commands["serve"] = &command{
+		usage: "serve [flags]\n\tpreview the generated maps and paths in a web browser",
+		run:   serve,
+	}
+}
+
+func serve(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	root := fs.String("root", "", "the LivelyMap install folder. found from openmw.cfg if not set")
+	addr := fs.String("addr", "localhost:8080", "address to listen on")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	if len(*root) == 0 {
+		_, rootPath, err := loadEnv(*cfgPath)
+		if err != nil {
+			return err
+		}
+		if len(rootPath) == 0 {
+			return fmt.Errorf("can't find %s in %q; set -root", plugin_name, *cfgPath)
+		}
+		*root = rootPath
+	}
+
+	listener, err := net.Listen("tcp", *addr)
+	if err != nil {
+		return fmt.Errorf("listen on %q: %w", *addr, err)
+	}
+	server := &http.Server{Handler: preview.NewServer(*root)}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	fmt.Printf("Serving %q at http://%s/\n", *root, listener.Addr())
+	if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("serve: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"text/tabwriter"
+
+	"github.com/erinpentecost/LivelyMap/internal/savefile"
+)
+
+func init() {
+	commands["stats"] = &command{
+		usage: "stats [flags] <character>\n\tsum up how far a character has gone, and where they've spent their time",
+		run:   stats,
+	}
+}
+
+func stats(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("stats", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	format := fs.String("format", "table", "output format, one of: table,json")
+	outPath := fs.String("out", "", "output file (default stdout)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return fmt.Errorf("expected one character, got %d", fs.NArg())
+	}
+
+	_, rootPath, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	journey, err := savefile.CharacterStats(rootPath, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if len(*outPath) > 0 {
+		file, err := os.Create(*outPath)
+		if err != nil {
+			return fmt.Errorf("create %q: %w", *outPath, err)
+		}
+		defer file.Close()
+		out = file
+	}
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(journey)
+	case "table":
+		return writeStatsTable(out, journey)
+	default:
+		return fmt.Errorf("unknown format %q", *format)
+	}
+}
+
+// byTime lists the keys of times, most time first.
+func byTime(times map[string]uint64) []string {
+	keys := []string{}
+	for key := range times {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b string) int {
+		return cmp.Or(cmp.Compare(times[b], times[a]), cmp.Compare(a, b))
+	})
+	return keys
+}
+
+// hours formats game seconds as hours.
+func hours(seconds uint64) string {
+	return fmt.Sprintf("%.1f h", float64(seconds)/3600)
+}
+
+func writeStatsTable(out io.Writer, s *savefile.JourneyStats) error {
+	w := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+	fmt.Fprintf(w, "Character\t%s\n", s.Character)
+	fmt.Fprintf(w, "Entries\t%d\n", s.Entries)
+	fmt.Fprintf(w, "Game time\t%d to %d (%s)\n", s.FirstTime, s.LastTime, hours(s.LastTime-s.FirstTime))
+	fmt.Fprintf(w, "Distance\t%.0f units (%.1f cells)\n", s.Distance, s.DistanceCells)
+	fmt.Fprintf(w, "Cells visited\t%d\n", s.Cells)
+	fmt.Fprintf(w, "Interiors visited\t%d\n", s.Interiors)
+	fmt.Fprintf(w, "Teleports\t%d\n", s.Teleports)
+	if s.LongestTrip != nil {
+		fmt.Fprintf(w, "Longest trip\t%.0f units, from %d to %d\n",
+			s.LongestTrip.Distance, s.LongestTrip.From, s.LongestTrip.To)
+	}
+	if len(s.Regions) > 0 {
+		fmt.Fprintln(w, "\nREGION\tTIME")
+		for _, region := range byTime(s.Regions) {
+			fmt.Fprintf(w, "%s\t%s\n", region, hours(s.Regions[region]))
+		}
+	}
+	if len(s.Submaps) > 0 {
+		fmt.Fprintln(w, "\nSUBMAP\tTIME")
+		for _, submap := range byTime(s.Submaps) {
+			fmt.Fprintf(w, "%s\t%s\n", submap, hours(s.Submaps[submap]))
+		}
+	}
+	return w.Flush()
+}
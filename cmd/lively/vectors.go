@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	"github.com/erinpentecost/LivelyMap/internal/hdmap"
+)
+
+func init() {
+	commands["vectors"] = &command{
+		usage: "vectors [flags]\n\ttrace coastlines and contours into GeoJSON and SVG",
+		run:   vectors,
+	}
+}
+
+func vectors(ctx context.Context, args []string) error {
+	fs := flag.NewFlagSet("vectors", flag.ExitOnError)
+	cfgPath := fs.String("cfg", "./openmw.cfg", "full path to your openmw.cfg file")
+	samples := fs.Int("samples", 16, "height samples along each cell edge. one of: 1,2,4,8,16,32,64")
+	contours := fs.Float64("contours", 0, "if set, also trace contour lines this many world units apart")
+	tolerance := fs.Float64("tolerance", 128, "how far, in world units, simplified lines can stray from the traced ones")
+	geojsonPath := fs.String("geojson", "map.geojson", "where to write the GeoJSON. leave empty to skip it")
+	svgPath := fs.String("svg", "map.svg", "where to write the SVG. leave empty to skip it")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	env, _, err := loadEnv(*cfgPath)
+	if err != nil {
+		return err
+	}
+	if err := hdmap.ExportVectors(env, hdmap.VectorOptions{
+		SamplesPerCell:  *samples,
+		ContourInterval: *contours,
+		Tolerance:       *tolerance,
+		GeoJSONPath:     *geojsonPath,
+		SVGPath:         *svgPath,
+	}); err != nil {
+		return fmt.Errorf("export vectors: %w", err)
+	}
+	return nil
+}
@@ -13,7 +13,7 @@ const (
 	ddsMagicLen   = 4
 	ddsHdrLen     = 124
 	totalHdrLen   = ddsMagicLen + ddsHdrLen // 128
-	pfOffsetInHdr = 76                      // pixel format start inside the 124-byte header
+	pfOffsetInHdr = 72                      // pixel format start inside the 124-byte header
 )
 
 // Decode parses a DDS file (given as bytes) and returns an image.Image.
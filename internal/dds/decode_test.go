@@ -1,6 +1,9 @@
 package dds
 
 import (
+	"bytes"
+	"image"
+	"image/color"
 	"os"
 	"testing"
 
@@ -17,3 +20,14 @@ func TestDecode1(t *testing.T) {
 	require.Equal(t, 16, img.Bounds().Dx())
 	require.Equal(t, 16, img.Bounds().Dy())
 }
+
+func TestDecodeLossless(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 2))
+	img.SetRGBA(1, 1, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x40})
+	buf := &bytes.Buffer{}
+	require.NoError(t, EncodeLossless(buf, img))
+	decoded, err := Decode(buf.Bytes())
+	require.NoError(t, err)
+	require.Equal(t, img.Bounds(), decoded.Bounds())
+	require.Equal(t, color.RGBA{R: 0x10, G: 0x20, B: 0x30, A: 0x40}, decoded.At(1, 1))
+}
@@ -0,0 +1,80 @@
+// Package geojson writes the small subset of GeoJSON (RFC 7946) that
+// LivelyMap exports.
+//
+// Coordinates are not longitude and latitude. They are Morrowind world
+// units: x grows to the east, y grows to the north, and each cell is
+// 8192 units wide, with cell 0,0 starting at the origin. Journeys can
+// be exported in longitude and latitude instead; see
+// savefile.Project.
+package geojson
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+type Geometry struct {
+	Type        string `json:"type"`
+	Coordinates any    `json:"coordinates"`
+}
+
+func LineString(points [][2]float64) *Geometry {
+	return &Geometry{Type: "LineString", Coordinates: points}
+}
+
+func Point(x, y float64) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: [2]float64{x, y}}
+}
+
+// LineStringZ is a LineString with a height for each point.
+func LineStringZ(points [][3]float64) *Geometry {
+	return &Geometry{Type: "LineString", Coordinates: points}
+}
+
+// PointZ is a Point with a height.
+func PointZ(x, y, z float64) *Geometry {
+	return &Geometry{Type: "Point", Coordinates: [3]float64{x, y, z}}
+}
+
+func Polygon(rings ...[][2]float64) *Geometry {
+	return &Geometry{Type: "Polygon", Coordinates: rings}
+}
+
+type Feature struct {
+	Type       string         `json:"type"`
+	Geometry   *Geometry      `json:"geometry"`
+	Properties map[string]any `json:"properties"`
+}
+
+func NewFeature(geometry *Geometry, properties map[string]any) *Feature {
+	if properties == nil {
+		properties = map[string]any{}
+	}
+	return &Feature{Type: "Feature", Geometry: geometry, Properties: properties}
+}
+
+type FeatureCollection struct {
+	Type     string     `json:"type"`
+	Features []*Feature `json:"features"`
+}
+
+func NewFeatureCollection() *FeatureCollection {
+	return &FeatureCollection{Type: "FeatureCollection", Features: []*Feature{}}
+}
+
+func (f *FeatureCollection) Add(feature *Feature) {
+	f.Features = append(f.Features, feature)
+}
+
+// Write saves the collection to path.
+func (f *FeatureCollection) Write(path string) error {
+	raw, err := json.Marshal(f)
+	if err != nil {
+		return fmt.Errorf("marshal geojson: %w", err)
+	}
+	if err := os.WriteFile(path, raw, 0666); err != nil {
+		return fmt.Errorf("write geojson %q: %w", path, err)
+	}
+	return nil
+}
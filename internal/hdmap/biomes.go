@@ -0,0 +1,190 @@
+package hdmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"os"
+	"regexp"
+
+	_ "embed"
+)
+
+//go:embed biomes.json
+var defaultBiomeRules []byte
+
+// unknownBiome is used for textures that no rule matches.
+const unknownBiome = "unknown"
+
+// waterBiome is the palette entry used for anything underwater.
+const waterBiome = "water"
+
+// BiomeRule maps land textures to a biome.
+type BiomeRule struct {
+	Biome string
+	// Patterns are case-insensitive regular expressions matched
+	// against the LTEX ID and texture path. Any match is enough.
+	Patterns []string
+
+	patterns []*regexp.Regexp
+}
+
+// BiomeRules classifies land textures into biomes.
+type BiomeRules struct {
+	// Palette maps biomes to colors like "#6c8a3c".
+	Palette map[string]string
+	// Rules are checked in order, and the first match wins.
+	Rules []*BiomeRule
+
+	palette map[string]color.RGBA
+}
+
+// LoadBiomeRules reads rules from a json file, or the built-in
+// rules if path is "default".
+func LoadBiomeRules(path string) (*BiomeRules, error) {
+	raw := defaultBiomeRules
+	if path != "default" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read biome rules %q: %w", path, err)
+		}
+	}
+	rules := &BiomeRules{}
+	if err := json.Unmarshal(raw, rules); err != nil {
+		return nil, fmt.Errorf("parse biome rules %q: %w", path, err)
+	}
+	rules.palette = map[string]color.RGBA{}
+	for biome, hex := range rules.Palette {
+		c, err := parseHexColor(hex)
+		if err != nil {
+			return nil, fmt.Errorf("bad color for %q: %w", biome, err)
+		}
+		rules.palette[biome] = c
+	}
+	for _, rule := range rules.Rules {
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q for %q: %w", pattern, rule.Biome, err)
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+		if _, ok := rules.palette[rule.Biome]; !ok {
+			return nil, fmt.Errorf("no palette color for %q", rule.Biome)
+		}
+	}
+	if _, ok := rules.palette[unknownBiome]; !ok {
+		rules.palette[unknownBiome] = color.RGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff}
+	}
+	if _, ok := rules.palette[waterBiome]; !ok {
+		rules.palette[waterBiome] = color.RGBA{R: 0x3a, G: 0x5a, B: 0x78, A: 0xff}
+	}
+	return rules, nil
+}
+
+// Classify finds the biome of a land texture.
+func (b *BiomeRules) Classify(name *LandTextureName) string {
+	if name == nil {
+		return unknownBiome
+	}
+	for _, rule := range b.Rules {
+		for _, re := range rule.patterns {
+			if re.MatchString(name.ID) || re.MatchString(name.Path) {
+				return rule.Biome
+			}
+		}
+	}
+	return unknownBiome
+}
+
+// textureBiomes classifies every land texture, keyed by VTEX value.
+func (b *BiomeRules) textureBiomes(names map[uint16]*LandTextureName) map[uint16]string {
+	out := map[uint16]string{}
+	for idx, name := range names {
+		out[idx] = b.Classify(name)
+	}
+	return out
+}
+
+// textureAt returns the VTEX value for a texture patch. Rows go from
+// south to north, and columns from west to east. VTEX is stored as a
+// 4x4 grid of 4x4 blocks, so it has to be unshuffled.
+// https://github.com/OpenMW/openmw/blob/master/components/esm3/loadland.cpp
+func (p *ParsedLandRecord) textureAt(row, col int) (uint16, bool) {
+	i := ((row/4)*4+col/4)*16 + (row%4)*4 + col%4
+	if len(p.vtex) != 16 || len(p.vtex[i/16]) != 16 {
+		return 0, false
+	}
+	return p.vtex[i/16][i%16], true
+}
+
+// BiomeHistograms counts the texture patches of each biome in every
+// real cell, keyed by "x,y".
+func (l *LandParser) BiomeHistograms(rules *BiomeRules) map[string]map[string]int {
+	biomes := rules.textureBiomes(l.TextureNames)
+	out := map[string]map[string]int{}
+	for _, p := range l.Lands {
+		if p.fake {
+			continue
+		}
+		histogram := map[string]int{}
+		for row := range 16 {
+			for col := range 16 {
+				if tex, ok := p.textureAt(row, col); ok {
+					histogram[biomeOf(biomes, tex)]++
+				}
+			}
+		}
+		if len(histogram) > 0 {
+			out[fmt.Sprintf("%d,%d", p.x, p.y)] = histogram
+		}
+	}
+	return out
+}
+
+func biomeOf(biomes map[uint16]string, tex uint16) string {
+	if biome, ok := biomes[tex]; ok {
+		return biome
+	}
+	return unknownBiome
+}
+
+// BiomeRenderer paints each texture patch with the color of its biome.
+// Anything underwater is drawn with the "water" palette color.
+type BiomeRenderer struct {
+	rules       *BiomeRules
+	biomes      map[uint16]string
+	waterHeight float32
+}
+
+func NewBiomeRenderer(rules *BiomeRules, names map[uint16]*LandTextureName) *BiomeRenderer {
+	return &BiomeRenderer{
+		rules:  rules,
+		biomes: rules.textureBiomes(names),
+	}
+}
+
+func (d *BiomeRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	d.waterHeight = waterHeight
+}
+
+func (d *BiomeRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	for y := range gridSize {
+		for x := range gridSize {
+			// Need to invert y
+			iy := gridSize - y - 1
+			c := d.rules.palette[unknownBiome]
+			if tex, ok := p.textureAt(y/4, x/4); ok {
+				c = d.rules.palette[biomeOf(d.biomes, tex)]
+			}
+			if p.heights[y][x] < d.waterHeight {
+				c = d.rules.palette[waterBiome]
+			}
+			img.SetRGBA(x, iy, c)
+		}
+	}
+	return img
+}
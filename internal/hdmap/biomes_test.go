@@ -0,0 +1,76 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/land"
+	"github.com/ernmw/omwpacker/esm/record/ltex"
+	"github.com/stretchr/testify/require"
+)
+
+func ltexRecord(id string, index uint32, path string) *esm.Record {
+	intv := make([]byte, 4)
+	binary.LittleEndian.PutUint32(intv, index)
+	return &esm.Record{
+		Tag: ltex.LTEX,
+		Subrecords: []*esm.Subrecord{
+			{Tag: ltex.NAME, Data: zdata(id)},
+			{Tag: ltex.INTV, Data: intv},
+			{Tag: ltex.DATA, Data: zdata(path)},
+		},
+	}
+}
+
+// withTextures adds a VTEX to a LAND record. texture is called with
+// each patch's row (south to north) and column.
+func withTextures(rec *esm.Record, texture func(row, col int) uint16) *esm.Record {
+	data := make([]byte, 16*16*2)
+	for row := range 16 {
+		for col := range 16 {
+			i := ((row/4)*4+col/4)*16 + (row%4)*4 + col%4
+			binary.LittleEndian.PutUint16(data[i*2:], texture(row, col))
+		}
+	}
+	rec.Subrecords = append(rec.Subrecords, &esm.Subrecord{Tag: land.VTEX, Data: data})
+	return rec
+}
+
+func TestBiomes(t *testing.T) {
+	rules, err := LoadBiomeRules("default")
+	require.NoError(t, err)
+	require.Equal(t, "grass", rules.Classify(&LandTextureName{ID: "AI Grass 01", Path: "textures/tx_ai_grass_01.tga"}))
+	require.Equal(t, "swamp", rules.Classify(&LandTextureName{ID: "BC Mud 01", Path: "textures/tx_bc_mud_01.tga"}))
+	require.Equal(t, "road", rules.Classify(&LandTextureName{ID: "Road Dirt", Path: "textures/tx_road_dirt.tga"}))
+	require.Equal(t, unknownBiome, rules.Classify(&LandTextureName{ID: "Sand", Path: "textures/tx_sand_01.tga"}))
+
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm",
+		ltexRecord("AI Grass 01", 0, `tx_ai_grass_01.tga`),
+		ltexRecord("Road Dirt", 1, `tx_road_dirt.tga`),
+		// the west half is grass, and the east half is a road
+		withTextures(landRecord(0, 0, 1), func(row, col int) uint16 {
+			if col < 8 {
+				return 1
+			}
+			return 2
+		}),
+	)
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+
+	histograms := lp.BiomeHistograms(rules)
+	require.Equal(t, map[string]int{"grass": 128, "road": 128}, histograms["0,0"])
+
+	renderer := NewBiomeRenderer(rules, lp.TextureNames)
+	renderer.SetHeightExtents(lp.Heights, -1000)
+	for _, p := range lp.Lands {
+		if p.x == 0 && p.y == 0 && !p.fake {
+			img := renderer.Render(p)
+			require.Equal(t, rules.palette["grass"], img.RGBAAt(0, 0))
+			require.Equal(t, rules.palette["road"], img.RGBAAt(gridSize-1, gridSize-1))
+		}
+	}
+}
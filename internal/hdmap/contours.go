@@ -0,0 +1,115 @@
+package hdmap
+
+// contourSegment is a piece of a contour line inside one grid square.
+// Its ends are keys of the square edges they sit on.
+type contourSegment struct {
+	a, b int
+}
+
+// contour traces the lines where the height grid crosses level with
+// marching squares. Lines are in world units. Closed loops end on
+// the point they start with. Lines that run off the grid are left open.
+func (g *heightGrid) contour(level float32) [][][2]float64 {
+	w := g.width
+	above := func(x, y int) bool { return g.at(x, y) >= level }
+	// Each grid edge has a key. Horizontal edges run east from x,y,
+	// and vertical edges run north from x,y.
+	hKey := func(x, y int) int { return 2 * (y*w + x) }
+	vKey := func(x, y int) int { return 2*(y*w+x) + 1 }
+
+	points := map[int][2]float64{}
+	cross := func(key, x0, y0, x1, y1 int) {
+		if _, ok := points[key]; ok {
+			return
+		}
+		h0, h1 := g.at(x0, y0), g.at(x1, y1)
+		t := float64((level - h0) / (h1 - h0))
+		points[key] = g.world(float64(x0)+t*float64(x1-x0), float64(y0)+t*float64(y1-y0))
+	}
+
+	segments := []contourSegment{}
+	for y := 0; y+1 < g.height; y++ {
+		for x := 0; x+1 < w; x++ {
+			bl, br := above(x, y), above(x+1, y)
+			tl, tr := above(x, y+1), above(x+1, y+1)
+			// Crossed edges, counterclockwise from the bottom.
+			edges := []int{}
+			if bl != br {
+				cross(hKey(x, y), x, y, x+1, y)
+				edges = append(edges, hKey(x, y))
+			}
+			if br != tr {
+				cross(vKey(x+1, y), x+1, y, x+1, y+1)
+				edges = append(edges, vKey(x+1, y))
+			}
+			if tr != tl {
+				cross(hKey(x, y+1), x, y+1, x+1, y+1)
+				edges = append(edges, hKey(x, y+1))
+			}
+			if tl != bl {
+				cross(vKey(x, y), x, y, x, y+1)
+				edges = append(edges, vKey(x, y))
+			}
+			switch len(edges) {
+			case 2:
+				segments = append(segments, contourSegment{edges[0], edges[1]})
+			case 4:
+				// A saddle. The average of the corners decides
+				// which pair of opposite corners is joined.
+				center := (g.at(x, y)+g.at(x+1, y)+g.at(x, y+1)+g.at(x+1, y+1))/4 >= level
+				if center == bl {
+					// bottom-right and top-left are cut off
+					segments = append(segments, contourSegment{edges[0], edges[1]}, contourSegment{edges[2], edges[3]})
+				} else {
+					// bottom-left and top-right are cut off
+					segments = append(segments, contourSegment{edges[3], edges[0]}, contourSegment{edges[1], edges[2]})
+				}
+			}
+		}
+	}
+
+	// Chain the segments together through their shared edges.
+	byEdge := map[int][]int{}
+	for i, s := range segments {
+		byEdge[s.a] = append(byEdge[s.a], i)
+		byEdge[s.b] = append(byEdge[s.b], i)
+	}
+	used := make([]bool, len(segments))
+	walk := func(start int) [][2]float64 {
+		line := [][2]float64{points[start]}
+		for edge := start; ; {
+			next := -1
+			for _, i := range byEdge[edge] {
+				if !used[i] {
+					next = i
+					break
+				}
+			}
+			if next < 0 {
+				return line
+			}
+			used[next] = true
+			if segments[next].a == edge {
+				edge = segments[next].b
+			} else {
+				edge = segments[next].a
+			}
+			line = append(line, points[edge])
+		}
+	}
+	out := [][][2]float64{}
+	// Open lines first, so they're walked from one end.
+	for i, s := range segments {
+		for _, end := range []int{s.a, s.b} {
+			if !used[i] && len(byEdge[end]) == 1 {
+				out = append(out, walk(end))
+			}
+		}
+	}
+	for i, s := range segments {
+		if !used[i] {
+			out = append(out, walk(s.a))
+		}
+	}
+	return out
+}
@@ -0,0 +1,49 @@
+package hdmap
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// coneLands makes a 4x4 cell map with a round island in the middle.
+// Its coast is one cell from the center, and its peak is 1000 units up.
+func coneLands() *LandParser {
+	l := &LandParser{MapExtents: MapCoords{Left: 0, Bottom: 0, Right: 3, Top: 3}}
+	for cx := range int32(4) {
+		for cy := range int32(4) {
+			p := flatLand(cx, cy, 0)
+			for row := range cellVertices {
+				for col := range cellVertices {
+					x := float64(cx) + float64(col)/gridSize - 2
+					y := float64(cy) + float64(row)/gridSize - 2
+					p.heights[row][col] = float32(1000 * (1 - math.Hypot(x, y)))
+				}
+			}
+			l.Lands = append(l.Lands, p)
+		}
+	}
+	return l
+}
+
+func TestContour(t *testing.T) {
+	g := newHeightGrid(coneLands(), 16)
+	lines := g.contour(0)
+	require.Len(t, lines, 1)
+	coast := lines[0]
+	require.Equal(t, coast[0], coast[len(coast)-1], "the coast should be a loop")
+	for _, p := range coast {
+		require.InDelta(t, cellUnits, math.Hypot(p[0]-2*cellUnits, p[1]-2*cellUnits), cellUnits/16)
+	}
+
+	// Half way up is a smaller loop.
+	lines = g.contour(500)
+	require.Len(t, lines, 1)
+	for _, p := range lines[0] {
+		require.InDelta(t, cellUnits/2, math.Hypot(p[0]-2*cellUnits, p[1]-2*cellUnits), cellUnits/16)
+	}
+
+	// Nothing is this high.
+	require.Empty(t, g.contour(2000))
+}
@@ -0,0 +1,284 @@
+package hdmap
+
+import (
+	"cmp"
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/ernmw/omwpacker/cfg"
+)
+
+// diffHeightScale is the height difference, in world units,
+// that gets full intensity in the diff texture.
+const diffHeightScale = 256
+
+// CellDiff describes how a cell changed between two load orders.
+type CellDiff struct {
+	X int32
+	Y int32
+	// Added is set if only the new load order has the cell.
+	Added bool `json:",omitempty"`
+	// Removed is set if only the old load order has the cell.
+	Removed bool `json:",omitempty"`
+	// MaxHeightDelta is the largest change in vertex height.
+	MaxHeightDelta float32 `json:",omitempty"`
+	// TexturesChanged is the number of changed texture patches.
+	TexturesChanged int `json:",omitempty"`
+	// ColorsChanged is the number of changed vertex colors.
+	ColorsChanged int    `json:",omitempty"`
+	OldPlugin     string `json:",omitempty"`
+	NewPlugin     string `json:",omitempty"`
+}
+
+// LandDiff is the difference between two parsed load orders.
+type LandDiff struct {
+	Added   int
+	Removed int
+	Changed int
+	Cells   []*CellDiff
+
+	old    map[uint64]*ParsedLandRecord
+	new    map[uint64]*ParsedLandRecord
+	byCell map[uint64]*CellDiff
+}
+
+func realLands(l *LandParser) map[uint64]*ParsedLandRecord {
+	out := map[uint64]*ParsedLandRecord{}
+	for _, p := range l.Lands {
+		if !p.fake {
+			out[coordKey(p.x, p.y)] = p
+		}
+	}
+	return out
+}
+
+// DiffLands compares the real cells of two load orders.
+// Cells that didn't change are left out.
+func DiffLands(before, after *LandParser) *LandDiff {
+	diff := &LandDiff{
+		Cells:  []*CellDiff{},
+		old:    realLands(before),
+		new:    realLands(after),
+		byCell: map[uint64]*CellDiff{},
+	}
+
+	for key, n := range diff.new {
+		o, ok := diff.old[key]
+		if !ok {
+			diff.Added++
+			diff.byCell[key] = &CellDiff{X: n.x, Y: n.y, Added: true, NewPlugin: n.plugin}
+			continue
+		}
+		cell := compareLands(o, n)
+		if cell.MaxHeightDelta > 0 || cell.TexturesChanged > 0 || cell.ColorsChanged > 0 {
+			diff.Changed++
+			diff.byCell[key] = cell
+		}
+	}
+	for key, o := range diff.old {
+		if _, ok := diff.new[key]; !ok {
+			diff.Removed++
+			diff.byCell[key] = &CellDiff{X: o.x, Y: o.y, Removed: true, OldPlugin: o.plugin}
+		}
+	}
+
+	for _, cell := range diff.byCell {
+		diff.Cells = append(diff.Cells, cell)
+	}
+	slices.SortFunc(diff.Cells, func(a, b *CellDiff) int {
+		return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y))
+	})
+	return diff
+}
+
+func compareLands(o, n *ParsedLandRecord) *CellDiff {
+	out := &CellDiff{X: n.x, Y: n.y, OldPlugin: o.plugin, NewPlugin: n.plugin}
+	for row := range cellVertices {
+		for col := range cellVertices {
+			delta := float32(math.Abs(float64(n.heights[row][col] - o.heights[row][col])))
+			out.MaxHeightDelta = max(out.MaxHeightDelta, delta)
+			if vertexColor(o, row, col) != vertexColor(n, row, col) {
+				out.ColorsChanged++
+			}
+		}
+	}
+	for row := range len(n.vtex) {
+		for col := range len(n.vtex[row]) {
+			if row >= len(o.vtex) || col >= len(o.vtex[row]) || o.vtex[row][col] != n.vtex[row][col] {
+				out.TexturesChanged++
+			}
+		}
+	}
+	return out
+}
+
+// vertexColor returns the vertex color, or white if there isn't one.
+func vertexColor(p *ParsedLandRecord, row, col int) color.RGBA {
+	if len(p.colors) != cellVertices || len(p.colors[row]) != cellVertices {
+		return color.RGBA{R: math.MaxUint8, G: math.MaxUint8, B: math.MaxUint8, A: math.MaxUint8}
+	}
+	c := p.colors[row][col]
+	return color.RGBA{R: c.R, G: c.G, B: c.B, A: math.MaxUint8}
+}
+
+// DiffRenderer draws terrain in grayscale, with changes highlighted.
+// Red shows height changes, green shows texture changes, and blue
+// shows vertex color changes. Added cells are cyan and removed cells
+// are magenta.
+type DiffRenderer struct {
+	diff      *LandDiff
+	minHeight float32
+	maxHeight float32
+}
+
+func NewDiffRenderer(diff *LandDiff) *DiffRenderer {
+	return &DiffRenderer{diff: diff}
+}
+
+func (d *DiffRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	d.minHeight = max(waterHeight, float32(heightStats.Min()))
+	d.maxHeight = float32(heightStats.Max())
+}
+
+func (d *DiffRenderer) gray(v float32) float64 {
+	if v < d.minHeight {
+		return 0.1
+	}
+	denom := d.maxHeight - d.minHeight
+	if denom == 0 {
+		return 0.5
+	}
+	return 0.25 + 0.5*float64(min(1, (v-d.minHeight)/denom))
+}
+
+func (d *DiffRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	key := coordKey(p.x, p.y)
+	cell := d.diff.byCell[key]
+	old := d.diff.old[key]
+
+	for y := range gridSize {
+		for x := range gridSize {
+			// Need to invert y
+			iy := gridSize - y - 1
+			g := d.gray(p.heights[y][x])
+			r, gr, b := g, g, g
+			switch {
+			case cell == nil:
+			case cell.Added:
+				r = g * 0.3
+			case cell.Removed:
+				gr = g * 0.3
+			default:
+				if delta := math.Abs(float64(p.heights[y][x] - old.heights[y][x])); delta > 0 {
+					r = max(r, min(1, 0.4+delta/diffHeightScale))
+				}
+				ty, tx := y/4, x/4
+				if ty < len(p.vtex) && tx < len(p.vtex[ty]) &&
+					ty < len(old.vtex) && tx < len(old.vtex[ty]) &&
+					p.vtex[ty][tx] != old.vtex[ty][tx] {
+					gr = max(gr, 0.8)
+				}
+				if vertexColor(p, y, x) != vertexColor(old, y, x) {
+					b = max(b, 0.8)
+				}
+			}
+			img.SetRGBA(x, iy, color.RGBA{
+				R: uint8(r * math.MaxUint8),
+				G: uint8(gr * math.MaxUint8),
+				B: uint8(b * math.MaxUint8),
+				A: math.MaxUint8,
+			})
+		}
+	}
+	return img
+}
+
+// DiffOptions controls the output of DiffLoadOrders.
+type DiffOptions struct {
+	// ReportPath is where to write the json summary.
+	ReportPath string
+	// TexturePath, if set, is where to write the diff png.
+	TexturePath string
+}
+
+// DiffLoadOrders compares the landmass produced by two load orders.
+func DiffLoadOrders(ctx context.Context, oldEnv, newEnv *cfg.Environment, opts DiffOptions) (*LandDiff, error) {
+	fmt.Printf("Parsing old load order (%d plugins)...\n", len(oldEnv.Plugins))
+	oldLands := NewLandParser(oldEnv)
+	if err := oldLands.ParsePlugins(); err != nil {
+		return nil, fmt.Errorf("parse old plugins: %w", err)
+	}
+	fmt.Printf("Parsing new load order (%d plugins)...\n", len(newEnv.Plugins))
+	newLands := NewLandParser(newEnv)
+	if err := newLands.ParsePlugins(); err != nil {
+		return nil, fmt.Errorf("parse new plugins: %w", err)
+	}
+
+	diff := DiffLands(oldLands, newLands)
+	fmt.Printf("%d cells added, %d removed, %d changed.\n", diff.Added, diff.Removed, diff.Changed)
+
+	if len(opts.ReportPath) > 0 {
+		raw, err := json.MarshalIndent(diff, "", "  ")
+		if err != nil {
+			return nil, fmt.Errorf("marshal diff report: %w", err)
+		}
+		if err := os.WriteFile(opts.ReportPath, raw, 0666); err != nil {
+			return nil, fmt.Errorf("write diff report: %w", err)
+		}
+	}
+
+	if len(opts.TexturePath) == 0 {
+		return diff, nil
+	}
+
+	// Draw every new cell, plus the removed ones, over both extents.
+	extents := MapCoords{
+		Top:    max(oldLands.MapExtents.Top, newLands.MapExtents.Top),
+		Bottom: min(oldLands.MapExtents.Bottom, newLands.MapExtents.Bottom),
+		Left:   min(oldLands.MapExtents.Left, newLands.MapExtents.Left),
+		Right:  max(oldLands.MapExtents.Right, newLands.MapExtents.Right),
+	}
+	cells := map[uint64]*ParsedLandRecord{}
+	for _, p := range newLands.Lands {
+		cells[coordKey(p.x, p.y)] = p
+	}
+	for key, p := range diff.old {
+		if diff.byCell[key] != nil && diff.byCell[key].Removed {
+			cells[key] = p
+		}
+	}
+	floor := newShelfFiller(nil, float32(newLands.Heights.Quantile(0.1)), 0)
+	combined := &LandParser{Heights: newLands.Heights, MapExtents: extents}
+	for x := extents.Left; x <= extents.Right; x++ {
+		for y := extents.Bottom; y <= extents.Top; y++ {
+			if p, ok := cells[coordKey(x, y)]; ok {
+				combined.Lands = append(combined.Lands, p)
+			} else {
+				combined.Lands = append(combined.Lands, floor.Fill(x, y))
+			}
+		}
+	}
+
+	diffCells := NewCellMapper(combined, NewDiffRenderer(diff))
+	if err := diffCells.Generate(ctx); err != nil {
+		return nil, fmt.Errorf("generate cell maps: %w", err)
+	}
+	job := &mapRenderJob{
+		Directory: filepath.Dir(opts.TexturePath),
+		Name:      filepath.Base(opts.TexturePath),
+		Extents:   combined.MapExtents,
+		Cells:     diffCells,
+	}
+	if err := job.Draw(ctx); err != nil {
+		return nil, err
+	}
+	return diff, nil
+}
@@ -0,0 +1,49 @@
+package hdmap
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDiffLoadOrders(t *testing.T) {
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm", landRecord(0, 0, 1), landRecord(1, 0, 1), landRecord(2, 0, 1))
+	landmass := writePlugin(t, dir, "Landmass.esp", landRecord(1, 0, 5), landRecord(3, 0, 1))
+
+	oldEnv := &cfg.Environment{Plugins: []string{master}}
+	newEnv := &cfg.Environment{Plugins: []string{master, landmass}}
+
+	texture := filepath.Join(dir, "diff.png")
+	diff, err := DiffLoadOrders(t.Context(), oldEnv, newEnv, DiffOptions{TexturePath: texture})
+	require.NoError(t, err)
+	require.Equal(t, 1, diff.Added)
+	require.Equal(t, 0, diff.Removed)
+	require.Equal(t, 1, diff.Changed)
+	require.Len(t, diff.Cells, 2)
+
+	changed := diff.Cells[0]
+	require.Equal(t, int32(1), changed.X)
+	require.Equal(t, "master.esm", changed.OldPlugin)
+	require.Equal(t, "landmass.esp", changed.NewPlugin)
+	// VHGT offsets are in units of 8
+	require.Equal(t, float32(32), changed.MaxHeightDelta)
+
+	added := diff.Cells[1]
+	require.True(t, added.Added)
+	require.Equal(t, int32(3), added.X)
+	require.FileExists(t, texture)
+
+	// swapping them around turns adds into removes
+	reverse := DiffLands(mustParse(t, newEnv), mustParse(t, oldEnv))
+	require.Equal(t, 0, reverse.Added)
+	require.Equal(t, 1, reverse.Removed)
+}
+
+func mustParse(t *testing.T, env *cfg.Environment) *LandParser {
+	lp := NewLandParser(env)
+	require.NoError(t, lp.ParsePlugins())
+	return lp
+}
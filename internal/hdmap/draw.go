@@ -0,0 +1,82 @@
+package hdmap
+
+import (
+	"image"
+	"image/color"
+	"math"
+)
+
+// cellPixel converts a world position to a pixel position in the
+// rendered image for cell cx,cy. Images are flipped, so north is up.
+func cellPixel(cx, cy int32, wx, wy float32) (px float64, py float64) {
+	px = (float64(wx)/cellUnits - float64(cx)) * gridSize
+	py = gridSize - (float64(wy)/cellUnits-float64(cy))*gridSize
+	return px, py
+}
+
+// clipSegment clips a line segment to a rectangle with the
+// Liang–Barsky algorithm. ok is false if none of it is inside.
+func clipSegment(x0, y0, x1, y1, minX, minY, maxX, maxY float64) (cx0, cy0, cx1, cy1 float64, ok bool) {
+	dx, dy := x1-x0, y1-y0
+	t0, t1 := 0.0, 1.0
+	for _, edge := range [4][2]float64{
+		{-dx, x0 - minX},
+		{dx, maxX - x0},
+		{-dy, y0 - minY},
+		{dy, maxY - y0},
+	} {
+		p, q := edge[0], edge[1]
+		if p == 0 {
+			if q < 0 {
+				return 0, 0, 0, 0, false
+			}
+			continue
+		}
+		r := q / p
+		if p < 0 {
+			t0 = max(t0, r)
+		} else {
+			t1 = min(t1, r)
+		}
+		if t0 > t1 {
+			return 0, 0, 0, 0, false
+		}
+	}
+	return x0 + t0*dx, y0 + t0*dy, x0 + t1*dx, y0 + t1*dy, true
+}
+
+// drawSegment strokes a line of the given width onto img.
+// Parts of the line outside of img are skipped.
+func drawSegment(img *image.RGBA, x0, y0, x1, y1, width float64, c color.RGBA) {
+	b := img.Bounds()
+	pad := width
+	x0, y0, x1, y1, ok := clipSegment(x0, y0, x1, y1,
+		float64(b.Min.X)-pad, float64(b.Min.Y)-pad, float64(b.Max.X)+pad, float64(b.Max.Y)+pad)
+	if !ok {
+		return
+	}
+	steps := int(math.Ceil(max(math.Abs(x1-x0), math.Abs(y1-y0))))
+	for i := 0; i <= steps; i++ {
+		t := 0.0
+		if steps > 0 {
+			t = float64(i) / float64(steps)
+		}
+		drawDot(img, x0+t*(x1-x0), y0+t*(y1-y0), width/2, c)
+	}
+}
+
+// drawDot fills a circle onto img.
+func drawDot(img *image.RGBA, x, y, radius float64, c color.RGBA) {
+	r := max(radius, 0.5)
+	for py := int(math.Floor(y - r)); py <= int(math.Ceil(y+r)); py++ {
+		for px := int(math.Floor(x - r)); px <= int(math.Ceil(x+r)); px++ {
+			if !(image.Point{X: px, Y: py}).In(img.Bounds()) {
+				continue
+			}
+			dx, dy := float64(px)+0.5-x, float64(py)+0.5-y
+			if dx*dx+dy*dy <= r*r {
+				img.SetRGBA(px, py, c)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package hdmap
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Entrance is an exterior door that leads into an interior cell.
+type Entrance struct {
+	// X, Y, and Z are the world position of the door.
+	X float32
+	Y float32
+	Z float32
+	// CellX and CellY are the exterior cell the door is in.
+	CellX int32
+	CellY int32
+	// Door is the ID of the door object.
+	Door string
+	// Name is the display name of the door, if it has one.
+	Name string `json:",omitempty"`
+	// Destination is the ID of the interior cell the door leads to.
+	Destination string
+	// DestX, DestY, and DestZ are where the player ends up inside.
+	DestX float32
+	DestY float32
+	DestZ float32
+	// Submaps lists the submaps that show the door.
+	Submaps []SubmapID
+}
+
+// Entrances finds every exterior door that teleports into an interior.
+func (l *LandParser) Entrances(submaps []SubmapNode) []*Entrance {
+	out := []*Entrance{}
+	for _, ref := range l.exteriorRefs() {
+		if ref.dest == nil || len(ref.dest.Cell) == 0 {
+			continue
+		}
+		e := &Entrance{
+			X:           ref.x,
+			Y:           ref.y,
+			Z:           ref.z,
+			CellX:       worldToCell(ref.x),
+			CellY:       worldToCell(ref.y),
+			Door:        ref.object,
+			Destination: ref.dest.Cell,
+			DestX:       ref.dest.X,
+			DestY:       ref.dest.Y,
+			DestZ:       ref.dest.Z,
+		}
+		if obj, ok := l.objects[ref.object]; ok {
+			e.Name = obj.name
+		}
+		e.Submaps = submapsContaining(submaps, e.CellX, e.CellY)
+		out = append(out, e)
+	}
+	slices.SortFunc(out, func(a, b *Entrance) int {
+		return cmp.Or(
+			cmp.Compare(strings.ToLower(a.Destination), strings.ToLower(b.Destination)),
+			cmp.Compare(a.X, b.X),
+			cmp.Compare(a.Y, b.Y),
+		)
+	})
+	return out
+}
+
+func writeEntrances(path string, entrances []*Entrance) error {
+	raw, err := json.Marshal(entrances)
+	if err != nil {
+		return fmt.Errorf("marshal entrances json: %w", err)
+	}
+	return os.WriteFile(path, raw, 0666)
+}
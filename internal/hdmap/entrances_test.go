@@ -0,0 +1,75 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+	"github.com/stretchr/testify/require"
+)
+
+// doorSubrecords places a door at x,y that teleports to destCell.
+// An empty destCell teleports to the exterior.
+func doorSubrecords(index uint32, object string, x, y float32, destCell string, destX float32) []*esm.Subrecord {
+	dodt := make([]byte, 24)
+	binary.LittleEndian.PutUint32(dodt[0:4], math.Float32bits(destX))
+	subs := refSubrecords(index, object, x, y)
+	// destination comes before the position
+	subs = slices.Insert(subs, 2, &esm.Subrecord{Tag: cell.DODT, Data: dodt})
+	if len(destCell) > 0 {
+		subs = slices.Insert(subs, 3, &esm.Subrecord{Tag: refDNAM, Data: zdata(destCell)})
+	}
+	return subs
+}
+
+// interiorCellRecord makes an interior CELL record.
+func interiorCellRecord(name string, subs ...*esm.Subrecord) *esm.Record {
+	rec := cellRecord(name, 0, 0, "", subs...)
+	binary.LittleEndian.PutUint32(rec.Subrecords[1].Data[0:4], cellFlagInterior)
+	return rec
+}
+
+func doorRecord(id, name string) *esm.Record {
+	return &esm.Record{
+		Tag: DOOR,
+		Subrecords: []*esm.Subrecord{
+			{Tag: objNAME, Data: zdata(id)},
+			{Tag: objFNAM, Data: zdata(name)},
+		},
+	}
+}
+
+func TestEntrances(t *testing.T) {
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm",
+		doorRecord("ex_door", "Door"),
+		cellRecord("Balmora", 0, 0, "", slices.Concat(
+			doorSubrecords(1, "ex_door", 100, 200, "Balmora, Guild of Mages", 5),
+			// teleports to somewhere else outside
+			doorSubrecords(2, "ex_door", 300, 200, "", 5),
+			refSubrecords(3, "house", 100, 100),
+		)...),
+		interiorCellRecord("Balmora, Guild of Mages",
+			doorSubrecords(4, "in_door", 5, 0, "Balmora, Guild of Mages, Basement", 0)...,
+		),
+		landRecord(0, 0, 1),
+	)
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+
+	submaps := []SubmapNode{{ID: 3, Extents: MapCoords{Left: -1, Right: 1, Bottom: -1, Top: 1}}}
+	require.Equal(t, []*Entrance{{
+		X:           100,
+		Y:           200,
+		Door:        "ex_door",
+		Name:        "Door",
+		Destination: "Balmora, Guild of Mages",
+		DestX:       5,
+		Submaps:     []SubmapID{3},
+	}}, lp.Entrances(submaps))
+}
@@ -0,0 +1,192 @@
+package hdmap
+
+import (
+	"math"
+
+	"github.com/ernmw/omwpacker/esm/record/land"
+)
+
+// cellVertices is the number of vertices along one side of a LAND record.
+// Neighboring cells share their edge vertices.
+const cellVertices = gridSize + 1
+
+// shelfFiller synthesizes LAND data for cells that no plugin defines.
+//
+// Missing cells used to be flat slabs at the sea floor, which left a cliff
+// wherever a coastline met one. Instead, each vertex in a missing cell
+// looks at the real cells within shelfDistance and takes an inverse-distance
+// weighted blend of their nearest heights. That blend then eases down
+// to the floor as the vertex gets further from the nearest real land.
+// Since the weight of a real vertex is infinite at zero distance, the
+// shared edge between a real and a fake cell matches exactly.
+type shelfFiller struct {
+	real  map[uint64]*ParsedLandRecord
+	floor float32
+	// distance is the falloff distance, in vertices.
+	distance float64
+	// radius is how many cells away to look for real land.
+	radius int32
+	// flat is shared by all fake cells that are too far from any real land.
+	flat [][]float32
+}
+
+func newShelfFiller(real map[uint64]*ParsedLandRecord, floor float32, shelfCells float64) *shelfFiller {
+	flat := make([][]float32, cellVertices)
+	for i := range flat {
+		flat[i] = make([]float32, cellVertices)
+		for j := range flat[i] {
+			flat[i][j] = floor
+		}
+	}
+	distance := max(0, shelfCells) * gridSize
+	return &shelfFiller{
+		real:     real,
+		floor:    floor,
+		distance: distance,
+		radius:   int32(math.Ceil(distance / gridSize)),
+		flat:     flat,
+	}
+}
+
+// neighbors returns the real cells that might be within the falloff
+// distance of any vertex in cell x,y.
+func (s *shelfFiller) neighbors(x, y int32) []*ParsedLandRecord {
+	out := []*ParsedLandRecord{}
+	for dy := -s.radius; dy <= s.radius; dy++ {
+		for dx := -s.radius; dx <= s.radius; dx++ {
+			if n, ok := s.real[coordKey(x+dx, y+dy)]; ok {
+				out = append(out, n)
+			}
+		}
+	}
+	return out
+}
+
+// Fill makes a fake land record for cell x,y.
+func (s *shelfFiller) Fill(x, y int32) *ParsedLandRecord {
+	out := &ParsedLandRecord{
+		x:       x,
+		y:       y,
+		fake:    true,
+		heights: s.flat,
+		normals: fallbackNormals,
+		vtex:    fallbackVtex,
+	}
+
+	neighbors := s.neighbors(x, y)
+	if len(neighbors) == 0 || s.distance == 0 {
+		return out
+	}
+
+	hasColors := false
+	for _, n := range neighbors {
+		if len(n.colors) == cellVertices {
+			hasColors = true
+			break
+		}
+	}
+
+	out.heights = make([][]float32, cellVertices)
+	if hasColors {
+		out.colors = make([][]land.ColorField, cellVertices)
+	}
+	for row := range cellVertices {
+		out.heights[row] = make([]float32, cellVertices)
+		if hasColors {
+			out.colors[row] = make([]land.ColorField, cellVertices)
+		}
+		for col := range cellVertices {
+			h, c := s.sample(
+				int64(x)*gridSize+int64(col),
+				int64(y)*gridSize+int64(row),
+				neighbors)
+			out.heights[row][col] = h
+			if hasColors {
+				out.colors[row][col] = c
+			}
+		}
+	}
+	out.normals = computeNormals(out.heights)
+	return out
+}
+
+// sample computes the height and vertex color at the global vertex gx,gy.
+func (s *shelfFiller) sample(gx, gy int64, neighbors []*ParsedLandRecord) (float32, land.ColorField) {
+	white := land.ColorField{R: math.MaxUint8, G: math.MaxUint8, B: math.MaxUint8}
+
+	var weightSum, heightSum float64
+	var r, g, b float64
+	closest := math.Inf(1)
+	for _, n := range neighbors {
+		// nearest vertex of n to gx,gy
+		left := int64(n.x) * gridSize
+		bottom := int64(n.y) * gridSize
+		cx := min(max(gx, left), left+gridSize)
+		cy := min(max(gy, bottom), bottom+gridSize)
+		col := int(cx - left)
+		row := int(cy - bottom)
+
+		dist := math.Hypot(float64(gx-cx), float64(gy-cy))
+		color := white
+		if len(n.colors) == cellVertices {
+			color = n.colors[row][col]
+		}
+		if dist == 0 {
+			// Shared edge vertex, so take it exactly.
+			return n.heights[row][col], color
+		}
+		closest = min(closest, dist)
+
+		falloff := 1 - dist/s.distance
+		if falloff <= 0 {
+			continue
+		}
+		weight := falloff * falloff / (dist * dist)
+		weightSum += weight
+		heightSum += weight * float64(n.heights[row][col]-s.floor)
+		r += weight * float64(color.R)
+		g += weight * float64(color.G)
+		b += weight * float64(color.B)
+	}
+
+	if weightSum == 0 {
+		return s.floor, white
+	}
+
+	// Ease toward the floor as we get further from the coast.
+	t := min(1, closest/s.distance)
+	shelf := (1 - t) * (1 - t)
+
+	height := s.floor + float32(shelf*heightSum/weightSum)
+	fade := func(v float64) uint8 {
+		return uint8(math.Round(math.MaxUint8 + shelf*(v/weightSum-math.MaxUint8)))
+	}
+	return height, land.ColorField{R: fade(r), G: fade(g), B: fade(b)}
+}
+
+// computeNormals derives VNML-style normals from a height grid.
+// Vertices are 128 units apart, and +Z is up.
+func computeNormals(heights [][]float32) [][]land.VertexField {
+	const spacing = 128.0
+	at := func(row, col int) float64 {
+		row = min(max(row, 0), len(heights)-1)
+		col = min(max(col, 0), len(heights[row])-1)
+		return float64(heights[row][col])
+	}
+
+	out := make([][]land.VertexField, len(heights))
+	for row := range heights {
+		out[row] = make([]land.VertexField, len(heights[row]))
+		for col := range heights[row] {
+			dx := (at(row, col+1) - at(row, col-1)) / (2 * spacing)
+			dy := (at(row+1, col) - at(row-1, col)) / (2 * spacing)
+			length := math.Sqrt(dx*dx + dy*dy + 1)
+			out[row][col] = land.VertexField{
+				X: int8(math.Round(-dx / length * math.MaxInt8)),
+				Y: int8(math.Round(-dy / length * math.MaxInt8)),
+				Z: int8(math.Round(1 / length * math.MaxInt8)),
+			}
+		}
+	}
+	return out
+}
@@ -0,0 +1,71 @@
+package hdmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func flatLand(x, y int32, height float32) *ParsedLandRecord {
+	heights := make([][]float32, cellVertices)
+	for row := range heights {
+		heights[row] = make([]float32, cellVertices)
+		for col := range heights[row] {
+			heights[row][col] = height
+		}
+	}
+	return &ParsedLandRecord{
+		x:       x,
+		y:       y,
+		heights: heights,
+		normals: fallbackNormals,
+		vtex:    fallbackVtex,
+	}
+}
+
+func TestShelfFillerMatchesCoast(t *testing.T) {
+	coast := flatLand(0, 0, 1000)
+	// slope the coast's east edge so we can tell rows apart
+	for row := range cellVertices {
+		coast.heights[row][gridSize] = float32(row * 10)
+	}
+	real := map[uint64]*ParsedLandRecord{coordKey(0, 0): coast}
+	filler := newShelfFiller(real, -500, 1)
+
+	fake := filler.Fill(1, 0)
+	require.True(t, fake.fake)
+	for row := range cellVertices {
+		// west edge of the fake cell is the east edge of the coast
+		require.Equal(t, coast.heights[row][gridSize], fake.heights[row][0], "row %d", row)
+		// east edge is a full cell away, so it should be sea floor
+		require.Equal(t, float32(-500), fake.heights[row][gridSize], "row %d", row)
+	}
+	// heights should shelve down as we move away from the coast
+	for col := 1; col < cellVertices; col++ {
+		require.LessOrEqual(t, fake.heights[32][col], fake.heights[32][col-1], "col %d", col)
+	}
+}
+
+func TestShelfFillerFarFromLand(t *testing.T) {
+	real := map[uint64]*ParsedLandRecord{coordKey(0, 0): flatLand(0, 0, 1000)}
+	filler := newShelfFiller(real, -500, 1)
+
+	fake := filler.Fill(5, 5)
+	require.True(t, fake.fake)
+	for row := range cellVertices {
+		for col := range cellVertices {
+			require.Equal(t, float32(-500), fake.heights[row][col])
+		}
+	}
+}
+
+func TestShelfFillerNoSeamBetweenFakes(t *testing.T) {
+	real := map[uint64]*ParsedLandRecord{coordKey(0, 0): flatLand(0, 0, 1000)}
+	filler := newShelfFiller(real, -500, 2.5)
+
+	a := filler.Fill(1, 1)
+	b := filler.Fill(2, 1)
+	for row := range cellVertices {
+		require.InDelta(t, a.heights[row][gridSize], b.heights[row][0], 0.001, "row %d", row)
+	}
+}
@@ -0,0 +1,177 @@
+package hdmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"regexp"
+
+	_ "embed"
+)
+
+//go:embed footprints.json
+var defaultFootprintRules []byte
+
+// FootprintRule classifies placed objects by their model path.
+type FootprintRule struct {
+	// Category is what the rule matches, like "road" or "building".
+	Category string
+	// Patterns are case-insensitive regular expressions matched
+	// against the model path. Any match is enough.
+	Patterns []string
+	// Color is the footprint color, like "#a89a7c".
+	Color string
+	// Width and Length are the footprint size in world units,
+	// before the reference's scale is applied. Length runs along
+	// the object's facing.
+	Width  float64
+	Length float64
+
+	patterns []*regexp.Regexp
+	color    color.RGBA
+}
+
+// LoadFootprintRules reads rules from a json file, or the built-in
+// rules if path is "default". Rules are checked in order, and the
+// first one that matches wins.
+func LoadFootprintRules(path string) ([]*FootprintRule, error) {
+	raw := defaultFootprintRules
+	if path != "default" {
+		var err error
+		raw, err = os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("read footprint rules %q: %w", path, err)
+		}
+	}
+	rules := []*FootprintRule{}
+	if err := json.Unmarshal(raw, &rules); err != nil {
+		return nil, fmt.Errorf("parse footprint rules %q: %w", path, err)
+	}
+	for _, rule := range rules {
+		for _, pattern := range rule.Patterns {
+			re, err := regexp.Compile("(?i)" + pattern)
+			if err != nil {
+				return nil, fmt.Errorf("bad pattern %q for %q: %w", pattern, rule.Category, err)
+			}
+			rule.patterns = append(rule.patterns, re)
+		}
+		c, err := parseHexColor(rule.Color)
+		if err != nil {
+			return nil, fmt.Errorf("bad color for %q: %w", rule.Category, err)
+		}
+		rule.color = c
+	}
+	return rules, nil
+}
+
+func parseHexColor(s string) (color.RGBA, error) {
+	c := color.RGBA{A: math.MaxUint8}
+	if _, err := fmt.Sscanf(s, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("parse color %q: %w", s, err)
+	}
+	return c, nil
+}
+
+func (r *FootprintRule) matches(model string) bool {
+	for _, re := range r.patterns {
+		if re.MatchString(model) {
+			return true
+		}
+	}
+	return false
+}
+
+// footprint is a classified reference.
+type footprint struct {
+	ref  *cellRef
+	rule *FootprintRule
+}
+
+// Footprints classifies exterior statics, activators, and doors.
+// The result is keyed by cell.
+func (l *LandParser) Footprints(rules []*FootprintRule) map[uint64][]*footprint {
+	out := map[uint64][]*footprint{}
+	for _, ref := range l.exteriorRefs() {
+		obj, ok := l.objects[ref.object]
+		if !ok || obj.tag == NPC_ || len(obj.model) == 0 {
+			continue
+		}
+		for _, rule := range rules {
+			if rule.matches(obj.model) {
+				out[ref.cellKey()] = append(out[ref.cellKey()], &footprint{ref: ref, rule: rule})
+				break
+			}
+		}
+	}
+	return out
+}
+
+// FootprintRenderer draws the footprints of buildings, roads,
+// walls, and so on. If Base is set, footprints are drawn over it.
+// Otherwise, the output is a transparent overlay.
+type FootprintRenderer struct {
+	Base       CellRenderer
+	footprints map[uint64][]*footprint
+}
+
+func NewFootprintRenderer(footprints map[uint64][]*footprint, base CellRenderer) *FootprintRenderer {
+	return &FootprintRenderer{Base: base, footprints: footprints}
+}
+
+func (d *FootprintRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	if d.Base != nil {
+		d.Base.SetHeightExtents(heightStats, waterHeight)
+	}
+}
+
+func (d *FootprintRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	var img *image.RGBA
+	if d.Base != nil {
+		img = d.Base.Render(p)
+	} else {
+		img = image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	}
+	// Footprints can hang over from neighboring cells.
+	for dx := int32(-1); dx <= 1; dx++ {
+		for dy := int32(-1); dy <= 1; dy++ {
+			for _, f := range d.footprints[coordKey(p.x+dx, p.y+dy)] {
+				drawFootprint(img, p.x, p.y, f)
+			}
+		}
+	}
+	return img
+}
+
+// drawFootprint fills the rotated rectangle covered by f.
+func drawFootprint(img *image.RGBA, cx, cy int32, f *footprint) {
+	scale := float64(f.ref.scale)
+	// in pixels
+	halfW := f.rule.Width * scale / 2 * gridSize / cellUnits
+	halfL := f.rule.Length * scale / 2 * gridSize / cellUnits
+	x, y := cellPixel(cx, cy, f.ref.x, f.ref.y)
+	reach := math.Hypot(halfW, halfL)
+	if x+reach < 0 || y+reach < 0 || x-reach > gridSize || y-reach > gridSize {
+		return
+	}
+	// Rotations are clockwise, looking down. Image y points south,
+	// so the facing direction is (sin, -cos).
+	sin, cos := math.Sincos(float64(f.ref.rotZ))
+	// Tiny footprints still get a pixel.
+	halfW, halfL = max(halfW, 0.5), max(halfL, 0.5)
+	for py := int(math.Floor(y - reach)); py <= int(math.Ceil(y+reach)); py++ {
+		for px := int(math.Floor(x - reach)); px <= int(math.Ceil(x+reach)); px++ {
+			if !(image.Point{X: px, Y: py}).In(img.Bounds()) {
+				continue
+			}
+			ox, oy := float64(px)+0.5-x, float64(py)+0.5-y
+			along := ox*sin - oy*cos
+			across := ox*cos + oy*sin
+			if math.Abs(along) <= halfL && math.Abs(across) <= halfW {
+				img.SetRGBA(px, py, f.rule.color)
+			}
+		}
+	}
+}
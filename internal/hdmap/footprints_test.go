@@ -0,0 +1,80 @@
+package hdmap
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/stretchr/testify/require"
+)
+
+func staticRecord(id, model string) *esm.Record {
+	return &esm.Record{
+		Tag: STAT,
+		Subrecords: []*esm.Subrecord{
+			{Tag: objNAME, Data: zdata(id)},
+			{Tag: objMODL, Data: zdata(model)},
+		},
+	}
+}
+
+func TestDefaultFootprintRules(t *testing.T) {
+	rules, err := LoadFootprintRules("default")
+	require.NoError(t, err)
+	classify := func(model string) string {
+		for _, rule := range rules {
+			if rule.matches(model) {
+				return rule.Category
+			}
+		}
+		return ""
+	}
+	require.Equal(t, "building", classify(`x\ex_hlaalu_b_01.nif`))
+	require.Equal(t, "building", classify(`x\Ex_Hlaalu_House_03.nif`))
+	require.Equal(t, "dock", classify(`x\ex_de_docks_steps_01.nif`))
+	require.Equal(t, "road", classify(`x\ex_vivec_bridge_01.nif`))
+	require.Equal(t, "wall", classify(`x\ex_redoran_wall_01.nif`))
+	require.Equal(t, "", classify(`f\flora_tree_ai_01.nif`))
+}
+
+func TestFootprints(t *testing.T) {
+	dir := t.TempDir()
+	rulesPath := filepath.Join(dir, "rules.json")
+	require.NoError(t, os.WriteFile(rulesPath, []byte(`[
+		{"Category": "building", "Patterns": ["house"], "Color": "#ff0000", "Width": 1024, "Length": 1024}
+	]`), 0666))
+	rules, err := LoadFootprintRules(rulesPath)
+	require.NoError(t, err)
+
+	master := writePlugin(t, dir, "Master.esm",
+		staticRecord("house", `x\ex_house_01.nif`),
+		staticRecord("rock", `x\ex_rock_01.nif`),
+		cellRecord("", 0, 0, "", slices.Concat(
+			refSubrecords(1, "house", cellUnits/2, cellUnits/2),
+			refSubrecords(2, "rock", 100, 100),
+			// hangs over into the next cell
+			refSubrecords(3, "house", cellUnits-64, 100),
+		)...),
+		landRecord(0, 0, 1),
+	)
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+
+	footprints := lp.Footprints(rules)
+	require.Len(t, footprints[coordKey(0, 0)], 2)
+
+	renderer := NewFootprintRenderer(footprints, nil)
+	img := renderer.Render(flatLand(0, 0, 0))
+	red := rules[0].color
+	// 1024 units is 8 pixels wide
+	require.Equal(t, red, img.RGBAAt(gridSize/2, gridSize/2))
+	require.Equal(t, red, img.RGBAAt(gridSize/2+3, gridSize/2-3))
+	require.Equal(t, uint8(0), img.RGBAAt(gridSize/2+5, gridSize/2).A)
+	require.Equal(t, uint8(0), img.RGBAAt(1, gridSize-1).A)
+
+	next := renderer.Render(flatLand(1, 0, 0))
+	require.Equal(t, red, next.RGBAAt(0, gridSize-1))
+}
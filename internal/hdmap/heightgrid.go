@@ -0,0 +1,64 @@
+package hdmap
+
+// heightGrid samples every cell's heights onto one grid that covers
+// the whole map. y grows to the north.
+type heightGrid struct {
+	// perCell is the number of samples along a cell edge.
+	perCell int
+	// left and bottom are the cell coordinates of sample 0,0.
+	left    int32
+	bottom  int32
+	width   int
+	height  int
+	heights []float32
+}
+
+// newHeightGrid samples the heights of every cell in the map.
+// perCell must divide gridSize.
+func newHeightGrid(l *LandParser, perCell int) *heightGrid {
+	g := &heightGrid{
+		perCell: perCell,
+		left:    l.MapExtents.Left,
+		bottom:  l.MapExtents.Bottom,
+		width:   int(l.MapExtents.Width()) * perCell,
+		height:  int(l.MapExtents.Height()) * perCell,
+	}
+	g.heights = make([]float32, g.width*g.height)
+	step := gridSize / perCell
+	for _, p := range l.Lands {
+		if l.MapExtents.NotContainsPoint(p.x, p.y) {
+			continue
+		}
+		ox := int(p.x-g.left) * perCell
+		oy := int(p.y-g.bottom) * perCell
+		for j := range perCell {
+			for i := range perCell {
+				g.heights[(oy+j)*g.width+ox+i] = p.heights[j*step][i*step]
+			}
+		}
+	}
+	return g
+}
+
+func (g *heightGrid) in(x, y int) bool {
+	return x >= 0 && y >= 0 && x < g.width && y < g.height
+}
+
+func (g *heightGrid) at(x, y int) float32 {
+	return g.heights[y*g.width+x]
+}
+
+// sample finds the sample under a pixel of a rendered cell.
+// px and py are in height order, so py grows to the north.
+func (g *heightGrid) sample(cx, cy int32, px, py int) (x int, y int) {
+	step := gridSize / g.perCell
+	return int(cx-g.left)*g.perCell + px/step, int(cy-g.bottom)*g.perCell + py/step
+}
+
+// world is the world position of a sample.
+func (g *heightGrid) world(x, y float64) [2]float64 {
+	return [2]float64{
+		(float64(g.left) + x/float64(g.perCell)) * cellUnits,
+		(float64(g.bottom) + y/float64(g.perCell)) * cellUnits,
+	}
+}
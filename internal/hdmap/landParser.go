@@ -15,8 +15,10 @@ import (
 
 	"github.com/erinpentecost/LivelyMap/internal/dds"
 	"github.com/erinpentecost/LivelyMap/internal/tdigest"
+	"github.com/ernmw/omwpacker/esm/record/cell"
 	"github.com/ernmw/omwpacker/esm/record/land"
 	"github.com/ernmw/omwpacker/esm/record/ltex"
+	"github.com/ernmw/omwpacker/esm/record/tes3"
 )
 
 var fallbackNormals [][]land.VertexField
@@ -62,16 +64,55 @@ type LandParser struct {
 	MapExtents   MapCoords
 	Lands        []*ParsedLandRecord
 	LandTextures map[uint16]image.Image
+	// TextureNames holds the ID and path of each land texture,
+	// keyed the same way as LandTextures.
+	TextureNames map[uint16]*LandTextureName
 	MaxHeight    float64
+	// ShelfDistance is how far, in cells, missing cells take to slope
+	// down from the nearest real land to the sea floor.
+	ShelfDistance float64
+	// SeamTolerance is the largest height difference, in world units,
+	// allowed between the shared edge vertices of neighboring cells.
+	SeamTolerance float32
+	// SeamNormalTolerance is the largest angle, in degrees, allowed
+	// between the shared edge normals of neighboring cells.
+	SeamNormalTolerance float64
+	// BlendSeams smooths over any seams that are found.
+	BlendSeams bool
+	// Seams holds mismatched cell edges found while parsing.
+	Seams []*Seam
+	// Regions holds every region, keyed by lowercase ID.
+	Regions map[string]*Region
+
+	// cells holds the winning header of each exterior CELL record.
+	cells map[uint64]*cellHeader
+	// masters holds the master list of each plugin.
+	masters map[string][]string
+	// refs holds the winning version of every placed reference.
+	refs map[refID]*cellRef
+	// objects holds the base records that references point to,
+	// keyed by lowercase ID.
+	objects map[string]*object
+
+	// landOverrides holds, for each cell, the plugins whose LAND
+	// records lost out to a later plugin. Newest first.
+	landOverrides map[uint64][]string
 }
 
 type ParsedLandRecord struct {
-	x       int32
-	y       int32
-	heights [][]float32
-	normals [][]land.VertexField
-	vtex    [][]uint16
-	colors  [][]land.ColorField
+	x int32
+	y int32
+	// fake is set for cells that weren't defined by any plugin.
+	fake bool
+	// plugin is the file name of the plugin the record came from.
+	plugin string
+	// overridden lists the plugins, in load order, that also defined
+	// this cell but lost to plugin.
+	overridden []string
+	heights    [][]float32
+	normals    [][]land.VertexField
+	vtex       [][]uint16
+	colors     [][]land.ColorField
 }
 
 func NewFallbackLandRecord() *ParsedLandRecord {
@@ -93,9 +134,19 @@ func NewFallbackLandRecord() *ParsedLandRecord {
 
 func NewLandParser(env *cfg.Environment) *LandParser {
 	return &LandParser{
-		Heights:      tdigest.New(),
-		LandTextures: map[uint16]image.Image{},
-		Env:          env,
+		Heights:             tdigest.New(),
+		LandTextures:        map[uint16]image.Image{},
+		TextureNames:        map[uint16]*LandTextureName{},
+		Env:                 env,
+		landOverrides:       map[uint64][]string{},
+		Regions:             map[string]*Region{},
+		cells:               map[uint64]*cellHeader{},
+		masters:             map[string][]string{},
+		refs:                map[refID]*cellRef{},
+		objects:             map[string]*object{},
+		ShelfDistance:       1,
+		SeamTolerance:       land.LandHeightScale,
+		SeamNormalTolerance: 15,
 	}
 }
 
@@ -129,7 +180,7 @@ func (l *LandParser) ParsePlugins() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	present := map[uint64]bool{}
+	present := map[uint64]*ParsedLandRecord{}
 
 	for rec := range l.loadPlugins(ctx) {
 		switch rec.Tag {
@@ -140,6 +191,7 @@ func (l *LandParser) ParsePlugins() error {
 				return fmt.Errorf("failed to parse LTEX record")
 			}
 			normalizedPath := strings.ToLower("textures/" + strings.ReplaceAll(path, "\\", "/"))
+			l.TextureNames[idx+1] = &LandTextureName{ID: ltexID(rec), Path: normalizedPath}
 			if img, err := l.readTexture(normalizedPath); err != nil {
 				// Lots of textures are missing; don't fail
 				// the whole run because of it.
@@ -149,13 +201,39 @@ func (l *LandParser) ParsePlugins() error {
 				// Have to add 1 to these according to components/esmterrain/storage.cpp#L378
 				l.LandTextures[idx+1] = img
 			}
+		case REGN:
+			region, err := parseRegion(rec)
+			if err != nil {
+				// One bad record shouldn't stop the whole map.
+				fmt.Printf("Skipping region record in %q: %v\n", rec.PluginName, err)
+				continue
+			}
+			l.Regions[regionID(region.ID)] = region
+		case cell.CELL:
+			header, err := parseCellHeader(rec)
+			if err != nil {
+				fmt.Printf("Skipping cell record in %q: %v\n", rec.PluginName, err)
+				continue
+			}
+			if err := l.addCell(rec, header); err != nil {
+				fmt.Printf("Skipping references in cell %q in %q: %v\n", header.name, rec.PluginName, err)
+			}
+			if header.interior {
+				continue
+			}
+			// Records come newest first, so the first one wins.
+			if _, ok := l.cells[coordKey(header.x, header.y)]; !ok {
+				l.cells[coordKey(header.x, header.y)] = header
+			}
+		case tes3.TES3:
+			l.masters[rec.PluginName] = parseMasters(rec)
 		case land.LAND:
 			parsed, err := l.parseLandRecord(rec)
 			if err != nil {
 				return fmt.Errorf("parse land record: %w", err)
 			}
 			l.Lands = append(l.Lands, parsed)
-			present[coordKey(parsed.x, parsed.y)] = true
+			present[coordKey(parsed.x, parsed.y)] = parsed
 			// calc XY extents
 			l.MapExtents.Left = min(l.MapExtents.Left, parsed.x)
 			l.MapExtents.Right = max(l.MapExtents.Right, parsed.x)
@@ -169,9 +247,29 @@ func (l *LandParser) ParsePlugins() error {
 					l.MaxHeight = max(l.MaxHeight, pointHeight)
 				}
 			}
+		default:
+			if objectTags[rec.Tag] {
+				obj, err := parseObject(rec)
+				if err != nil {
+					fmt.Printf("Skipping %s record in %q: %v\n", rec.Tag, rec.PluginName, err)
+					continue
+				}
+				l.objects[obj.id] = obj
+			}
 		}
 	}
 
+	for _, parsed := range l.Lands {
+		parsed.overridden = slices.Clone(l.landOverrides[coordKey(parsed.x, parsed.y)])
+		slices.Reverse(parsed.overridden)
+	}
+
+	l.Seams = l.FindSeams(l.SeamTolerance, l.SeamNormalTolerance)
+	fmt.Printf("Found %d cell seams.\n", len(l.Seams))
+	if l.BlendSeams {
+		BlendSeams(l.Lands, l.Seams)
+	}
+
 	// Put in some padding.
 	l.MapExtents = l.MapExtents.Extend(2, 2)
 	// Make sure the map isn't too thin.
@@ -191,27 +289,15 @@ func (l *LandParser) ParsePlugins() error {
 
 	// fill in empties
 	nearBottom := float32(l.Heights.Quantile(0.1))
-	fallbackHeights := make([][]float32, 65)
-	for i := range fallbackHeights {
-		fallbackHeights[i] = make([]float32, 65)
-		for b := range 65 {
-			fallbackHeights[i][b] = nearBottom
-		}
-	}
+	filler := newShelfFiller(present, nearBottom, l.ShelfDistance)
 
 	fmt.Println("Faking cells...")
 	fakeCount := 0
 	for x := l.MapExtents.Left; x <= l.MapExtents.Right; x++ {
 		for y := l.MapExtents.Bottom; y <= l.MapExtents.Top; y++ {
-			if !present[coordKey(x, y)] {
+			if _, ok := present[coordKey(x, y)]; !ok {
 				fakeCount++
-				l.Lands = append(l.Lands, &ParsedLandRecord{
-					x:       x,
-					y:       y,
-					heights: fallbackHeights,
-					normals: fallbackNormals,
-					vtex:    fallbackVtex,
-				})
+				l.Lands = append(l.Lands, filler.Fill(x, y))
 			}
 		}
 	}
@@ -242,6 +328,21 @@ func parseLtex(s *esm.Record) (index uint16, path string, err error) {
 	return
 }
 
+// LandTextureName identifies a land texture.
+type LandTextureName struct {
+	ID   string
+	Path string
+}
+
+func ltexID(rec *esm.Record) string {
+	for _, sub := range rec.Subrecords {
+		if sub.Tag == ltex.NAME {
+			return zstring(sub.Data)
+		}
+	}
+	return ""
+}
+
 func ensureAspectRatio(m MapCoords) MapCoords {
 	w := m.Width()
 	h := m.Height()
@@ -266,6 +367,8 @@ func ensureAspectRatio(m MapCoords) MapCoords {
 func (l *LandParser) loadPlugins(ctx context.Context) <-chan *esm.Record {
 	LTEXs := make(map[uint16]*esm.Record)
 	LANDs := make(map[string]*esm.Record)
+	REGNs := make(map[string]*esm.Record)
+	objects := make(map[string]*esm.Record)
 	type pluginsResp struct {
 		recs []*esm.Record
 		err  error
@@ -341,7 +444,12 @@ func (l *LandParser) loadPlugins(ctx context.Context) <-chan *esm.Record {
 					}
 
 					if _, filled := LANDs[key]; filled {
-						// alread filled out. skip.
+						// alread filled out. skip, but remember who lost.
+						coords := land.INTVField{}
+						if err := coords.Unmarshal(intv); err == nil {
+							ck := coordKey(coords.X, coords.Y)
+							l.landOverrides[ck] = append(l.landOverrides[ck], rec.PluginName)
+						}
 						continue
 					}
 					LANDs[key] = rec
@@ -350,8 +458,47 @@ func (l *LandParser) loadPlugins(ctx context.Context) <-chan *esm.Record {
 					case <-ctx.Done():
 						return
 					}
+				case REGN:
+					region, err := parseRegion(rec)
+					if err != nil {
+						fmt.Printf("failed to parse REGN record: %v\n", err)
+						continue
+					}
+					if _, filled := REGNs[regionID(region.ID)]; filled {
+						continue
+					}
+					REGNs[regionID(region.ID)] = rec
+					select {
+					case out <- rec:
+					case <-ctx.Done():
+						return
+					}
+				case cell.CELL, tes3.TES3:
+					// Every CELL is sent along, since they also carry references.
+					// Headers are needed to work out who owns each reference.
+					select {
+					case out <- rec:
+					case <-ctx.Done():
+						return
+					}
 				default:
-					continue
+					if !objectTags[rec.Tag] {
+						continue
+					}
+					obj, err := parseObject(rec)
+					if err != nil {
+						fmt.Printf("failed to parse %s record: %v\n", rec.Tag, err)
+						continue
+					}
+					if _, filled := objects[obj.id]; filled {
+						continue
+					}
+					objects[obj.id] = rec
+					select {
+					case out <- rec:
+					case <-ctx.Done():
+						return
+					}
 				}
 			}
 		}
@@ -364,7 +511,11 @@ func coordKey(x int32, y int32) uint64 {
 }
 
 func (l *LandParser) parseLandRecord(rec *esm.Record) (*ParsedLandRecord, error) {
-	out := &ParsedLandRecord{}
+	out := &ParsedLandRecord{
+		plugin:  rec.PluginName,
+		normals: fallbackNormals,
+		vtex:    fallbackVtex,
+	}
 	for _, subrec := range rec.Subrecords {
 		switch subrec.Tag {
 		case land.INTV:
@@ -0,0 +1,112 @@
+package hdmap
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+)
+
+// Place is a named exterior area, like a town, made up of
+// every exterior cell that shares the name.
+type Place struct {
+	Name string
+	// X and Y are the world position of the center of the place.
+	// This is the average position of everything placed in it.
+	X float32
+	Y float32
+	// CellX and CellY are the cell that X and Y fall in.
+	CellX int32
+	CellY int32
+	// Cells is the number of exterior cells with this name.
+	Cells int
+	// References is the number of objects placed in those cells.
+	References int
+	// Submaps lists the submaps that show any of the place's cells.
+	Submaps []SubmapID
+	// Score is a rough measure of how important the place is,
+	// from 0 to 1. The biggest place gets 1.
+	Score float64
+}
+
+// Places groups named exterior cells into places.
+func (l *LandParser) Places(submaps []SubmapNode) []*Place {
+	type accumulator struct {
+		place  *Place
+		cells  []*cellHeader
+		sumX   float64
+		sumY   float64
+		weight int
+	}
+	byName := map[string]*accumulator{}
+	byCell := map[uint64]*accumulator{}
+	for key, c := range l.cells {
+		if len(c.name) == 0 {
+			continue
+		}
+		id := strings.ToLower(c.name)
+		acc, ok := byName[id]
+		if !ok {
+			acc = &accumulator{place: &Place{Name: c.name, Submaps: []SubmapID{}}}
+			byName[id] = acc
+		}
+		acc.cells = append(acc.cells, c)
+		byCell[key] = acc
+	}
+
+	refCounts := map[uint64]int{}
+	for _, ref := range l.exteriorRefs() {
+		if acc, ok := byCell[ref.cellKey()]; ok {
+			refCounts[ref.cellKey()]++
+			acc.place.References++
+			acc.sumX += float64(ref.x)
+			acc.sumY += float64(ref.y)
+			acc.weight++
+		}
+	}
+
+	out := []*Place{}
+	maxReferences := 0
+	for _, acc := range byName {
+		p := acc.place
+		p.Cells = len(acc.cells)
+		// Empty cells still count, from their centers.
+		for _, c := range acc.cells {
+			if refCounts[coordKey(c.x, c.y)] == 0 {
+				acc.sumX += (float64(c.x) + 0.5) * cellUnits
+				acc.sumY += (float64(c.y) + 0.5) * cellUnits
+				acc.weight++
+			}
+			for _, id := range submapsContaining(submaps, c.x, c.y) {
+				if !slices.Contains(p.Submaps, id) {
+					p.Submaps = append(p.Submaps, id)
+				}
+			}
+		}
+		slices.Sort(p.Submaps)
+		p.X = float32(acc.sumX / float64(acc.weight))
+		p.Y = float32(acc.sumY / float64(acc.weight))
+		p.CellX, p.CellY = worldToCell(p.X), worldToCell(p.Y)
+		maxReferences = max(maxReferences, p.References)
+		out = append(out, p)
+	}
+	for _, p := range out {
+		if maxReferences > 0 {
+			p.Score = float64(p.References) / float64(maxReferences)
+		}
+	}
+	slices.SortFunc(out, func(a, b *Place) int {
+		return cmp.Or(cmp.Compare(b.Score, a.Score), cmp.Compare(a.Name, b.Name))
+	})
+	return out
+}
+
+func writePlaces(path string, places []*Place) error {
+	raw, err := json.Marshal(places)
+	if err != nil {
+		return fmt.Errorf("marshal places json: %w", err)
+	}
+	return os.WriteFile(path, raw, 0666)
+}
@@ -0,0 +1,81 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+	"github.com/ernmw/omwpacker/esm/record/tes3"
+	"github.com/stretchr/testify/require"
+)
+
+// refSubrecords places object at x,y as reference number index.
+func refSubrecords(index uint32, object string, x, y float32) []*esm.Subrecord {
+	frmr := make([]byte, 4)
+	binary.LittleEndian.PutUint32(frmr, index)
+	data := make([]byte, 24)
+	binary.LittleEndian.PutUint32(data[0:4], math.Float32bits(x))
+	binary.LittleEndian.PutUint32(data[4:8], math.Float32bits(y))
+	return []*esm.Subrecord{
+		{Tag: cell.FRMR, Data: frmr},
+		{Tag: objNAME, Data: zdata(object)},
+		{Tag: cell.DATA, Data: data},
+	}
+}
+
+func TestPlaces(t *testing.T) {
+	dir := t.TempDir()
+	town := slices.Concat(
+		refSubrecords(1, "house", 100, 100),
+		refSubrecords(2, "house", 300, 100),
+		refSubrecords(3, "house", 8192+200, 100),
+	)
+	master := writePlugin(t, dir, "Master.esm",
+		cellRecord("Balmora", 0, 0, "", town[:6]...),
+		cellRecord("Balmora", 1, 0, "", town[6:]...),
+		cellRecord("Hut", 3, 3, ""),
+		cellRecord("", 2, 0, "", refSubrecords(4, "rock", 2*8192, 0)...),
+		landRecord(0, 0, 1),
+	)
+	// the patch deletes one of the houses from its master
+	header, err := tes3.NewTES3Record("Patch", "")
+	require.NoError(t, err)
+	header.Subrecords = append(header.Subrecords,
+		&esm.Subrecord{Tag: tes3.MAST, Data: zdata("Master.esm")},
+		&esm.Subrecord{Tag: tes3.DATA, Data: make([]byte, 8)},
+	)
+	deleted := refSubrecords(1<<24|2, "house", 300, 100)
+	deleted = append(deleted, &esm.Subrecord{Tag: refDELE, Data: make([]byte, 4)})
+	patch := writePlugin(t, dir, "Patch.esp", header, cellRecord("Balmora", 0, 0, "", deleted...))
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master, patch}})
+	require.NoError(t, lp.ParsePlugins())
+
+	submaps := []SubmapNode{
+		{ID: 1, Extents: MapCoords{Left: -5, Right: 0, Bottom: -5, Top: 5}},
+		{ID: 2, Extents: MapCoords{Left: 1, Right: 5, Bottom: -5, Top: 5}},
+	}
+	places := lp.Places(submaps)
+	require.Len(t, places, 2)
+
+	balmora := places[0]
+	require.Equal(t, "Balmora", balmora.Name)
+	require.Equal(t, 2, balmora.Cells)
+	require.Equal(t, 2, balmora.References)
+	require.Equal(t, float32(100+8192+200)/2, balmora.X)
+	require.Equal(t, float32(100), balmora.Y)
+	require.Equal(t, []SubmapID{1, 2}, balmora.Submaps)
+	require.Equal(t, 1.0, balmora.Score)
+
+	hut := places[1]
+	require.Equal(t, "Hut", hut.Name)
+	require.Equal(t, 0, hut.References)
+	require.Equal(t, float32(3.5*8192), hut.X)
+	require.Equal(t, int32(3), hut.CellX)
+	require.Equal(t, []SubmapID{2}, hut.Submaps)
+	require.Equal(t, 0.0, hut.Score)
+}
@@ -0,0 +1,183 @@
+package hdmap
+
+import (
+	"cmp"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"math"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/erinpentecost/LivelyMap/internal/hue"
+	"github.com/ernmw/omwpacker/cfg"
+)
+
+// CellProvenance records which plugin won the LAND record for a cell.
+type CellProvenance struct {
+	X      int32
+	Y      int32
+	Plugin string
+	// Overrode lists the other plugins that define the cell,
+	// in load order.
+	Overrode []string
+	// Color is the cell's color in the provenance texture.
+	Color string
+}
+
+// Provenance lists the origin of every real cell, sorted by position.
+func (l *LandParser) Provenance() []*CellProvenance {
+	out := []*CellProvenance{}
+	for _, p := range l.Lands {
+		if p.fake {
+			continue
+		}
+		out = append(out, &CellProvenance{
+			X:        p.x,
+			Y:        p.y,
+			Plugin:   p.plugin,
+			Overrode: p.overridden,
+		})
+	}
+	slices.SortFunc(out, func(a, b *CellProvenance) int {
+		return cmp.Or(cmp.Compare(a.X, b.X), cmp.Compare(a.Y, b.Y))
+	})
+	return out
+}
+
+// ProvenanceRenderer colors each cell by the plugin that defined it.
+// Cells that override other plugins are checkered with the color of
+// the plugin they beat.
+type ProvenanceRenderer struct {
+	colors map[string]color.RGBA
+}
+
+// NewProvenanceRenderer assigns a color to each plugin.
+// plugins should be in load order.
+func NewProvenanceRenderer(plugins []string) *ProvenanceRenderer {
+	out := &ProvenanceRenderer{colors: map[string]color.RGBA{}}
+	for i, p := range plugins {
+		// Golden angle spacing keeps neighbors in the
+		// load order from looking alike.
+		out.colors[strings.ToLower(filepath.Base(p))] = hue.HSLToRGB(hue.HSL{
+			H: math.Mod(float64(i)*137.508, 360),
+			S: 0.7,
+			L: 0.35 + 0.3*float64(i%3)/2,
+		})
+	}
+	return out
+}
+
+func (d *ProvenanceRenderer) Color(plugin string) color.RGBA {
+	if c, ok := d.colors[plugin]; ok {
+		return c
+	}
+	return color.RGBA{A: math.MaxUint8}
+}
+
+func (d *ProvenanceRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {}
+
+func (d *ProvenanceRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	if p.fake {
+		return img
+	}
+	main := d.Color(p.plugin)
+	alt := main
+	if len(p.overridden) > 0 {
+		alt = d.Color(p.overridden[len(p.overridden)-1])
+	}
+	border := hue.MulColor(main, color.Gray{Y: 0x80})
+
+	const checker = gridSize / 8
+	for y := range gridSize {
+		for x := range gridSize {
+			c := main
+			if x == 0 || y == 0 {
+				c = border
+			} else if (x/checker+y/checker)%2 == 1 {
+				c = alt
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return img
+}
+
+// InspectOptions controls the output of InspectCells.
+type InspectOptions struct {
+	// Format is either "json" or "csv".
+	Format string
+	// Output receives the report.
+	Output io.Writer
+	// TexturePath, if set, is where to write a png of the cells
+	// colored by the plugin that defined them.
+	TexturePath string
+}
+
+// InspectCells reports which plugin defined each cell.
+func InspectCells(ctx context.Context, env *cfg.Environment, opts InspectOptions) error {
+	parsedLands := NewLandParser(env)
+	if err := parsedLands.ParsePlugins(); err != nil {
+		return fmt.Errorf("parse plugins: %w", err)
+	}
+
+	renderer := NewProvenanceRenderer(env.Plugins)
+	cells := parsedLands.Provenance()
+	for _, c := range cells {
+		col := renderer.Color(c.Plugin)
+		c.Color = fmt.Sprintf("#%02x%02x%02x", col.R, col.G, col.B)
+	}
+
+	switch opts.Format {
+	case "json":
+		enc := json.NewEncoder(opts.Output)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(cells); err != nil {
+			return fmt.Errorf("encode json: %w", err)
+		}
+	case "csv":
+		w := csv.NewWriter(opts.Output)
+		if err := w.Write([]string{"x", "y", "plugin", "overrode", "color"}); err != nil {
+			return fmt.Errorf("write csv header: %w", err)
+		}
+		for _, c := range cells {
+			if err := w.Write([]string{
+				strconv.Itoa(int(c.X)),
+				strconv.Itoa(int(c.Y)),
+				c.Plugin,
+				strings.Join(c.Overrode, ";"),
+				c.Color,
+			}); err != nil {
+				return fmt.Errorf("write csv row: %w", err)
+			}
+		}
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("flush csv: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown format %q", opts.Format)
+	}
+
+	if len(opts.TexturePath) == 0 {
+		return nil
+	}
+	provenanceCells := NewCellMapper(parsedLands, renderer)
+	if err := provenanceCells.Generate(ctx); err != nil {
+		return fmt.Errorf("generate cell maps: %w", err)
+	}
+	job := &mapRenderJob{
+		Directory: filepath.Dir(opts.TexturePath),
+		Name:      filepath.Base(opts.TexturePath),
+		Extents:   parsedLands.MapExtents,
+		Cells:     provenanceCells,
+	}
+	return job.Draw(ctx)
+}
@@ -0,0 +1,78 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/land"
+	"github.com/stretchr/testify/require"
+)
+
+// writePlugin writes records to a new plugin file in dir.
+func writePlugin(t *testing.T, dir string, name string, records ...*esm.Record) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	require.NoError(t, esm.WriteRecords(f, slices.Values(records)))
+	return path
+}
+
+// landRecord makes a flat LAND record for cell x,y.
+func landRecord(x, y int32, offset float32) *esm.Record {
+	intv := make([]byte, 8)
+	binary.LittleEndian.PutUint32(intv[0:4], uint32(x))
+	binary.LittleEndian.PutUint32(intv[4:8], uint32(y))
+	vhgt := land.VHGTField{Offset: offset, Heights: make([][]int8, cellVertices)}
+	for i := range vhgt.Heights {
+		vhgt.Heights[i] = make([]int8, cellVertices)
+	}
+	vhgtSub, err := vhgt.Marshal()
+	if err != nil {
+		panic(err)
+	}
+	return &esm.Record{
+		Tag: land.LAND,
+		Subrecords: []*esm.Subrecord{
+			{Tag: land.INTV, Data: intv},
+			vhgtSub,
+		},
+	}
+}
+
+func TestProvenance(t *testing.T) {
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm", landRecord(0, 0, 1), landRecord(1, 0, 1))
+	patch := writePlugin(t, dir, "Patch.esp", landRecord(1, 0, 2))
+	fix := writePlugin(t, dir, "Fix.esp", landRecord(1, 0, 3))
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master, patch, fix}})
+	require.NoError(t, lp.ParsePlugins())
+
+	cells := lp.Provenance()
+	require.Len(t, cells, 2)
+	require.Equal(t, &CellProvenance{X: 0, Y: 0, Plugin: "master.esm"}, cells[0])
+	require.Equal(t, &CellProvenance{
+		X:        1,
+		Y:        0,
+		Plugin:   "fix.esp",
+		Overrode: []string{"master.esm", "patch.esp"},
+	}, cells[1])
+
+	renderer := NewProvenanceRenderer(lp.Env.Plugins)
+	require.NotEqual(t, renderer.Color("master.esm"), renderer.Color("fix.esp"))
+	for _, p := range lp.Lands {
+		if p.x == 1 && p.y == 0 && !p.fake {
+			img := renderer.Render(p)
+			// checkered with the color of the plugin it beat
+			require.Equal(t, renderer.Color("fix.esp"), img.RGBAAt(1, 1))
+			require.Equal(t, renderer.Color("patch.esp"), img.RGBAAt(1+gridSize/8, 1))
+		}
+	}
+}
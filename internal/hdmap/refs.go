@@ -0,0 +1,230 @@
+package hdmap
+
+import (
+	"cmp"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+	"github.com/ernmw/omwpacker/esm/record/tes3"
+)
+
+// cellUnits is the width of a cell in world units.
+const cellUnits = 8192
+
+// Object records that placed references can point to.
+const (
+	STAT esm.RecordTag = "STAT"
+	ACTI esm.RecordTag = "ACTI"
+	DOOR esm.RecordTag = "DOOR"
+	NPC_ esm.RecordTag = "NPC_"
+)
+
+// objectTags are the object records that are kept around so
+// references can be classified.
+var objectTags = map[esm.RecordTag]bool{
+	STAT: true,
+	ACTI: true,
+	DOOR: true,
+	NPC_: true,
+}
+
+const (
+	objNAME esm.SubrecordTag = "NAME"
+	objFNAM esm.SubrecordTag = "FNAM"
+	objMODL esm.SubrecordTag = "MODL"
+	refDELE esm.SubrecordTag = "DELE"
+	refDNAM esm.SubrecordTag = "DNAM"
+)
+
+// object is a base record that references are placed from.
+type object struct {
+	tag   esm.RecordTag
+	id    string
+	name  string
+	model string
+	rec   *esm.Record
+}
+
+func parseObject(rec *esm.Record) (*object, error) {
+	out := &object{tag: rec.Tag, rec: rec}
+	for _, sub := range rec.Subrecords {
+		switch sub.Tag {
+		case objNAME:
+			out.id = strings.ToLower(zstring(sub.Data))
+		case objFNAM:
+			out.name = zstring(sub.Data)
+		case objMODL:
+			out.model = strings.ToLower(strings.ReplaceAll(zstring(sub.Data), "\\", "/"))
+		}
+	}
+	if len(out.id) == 0 {
+		return nil, fmt.Errorf("%s has no NAME", rec.Tag)
+	}
+	return out, nil
+}
+
+// refID identifies a placed reference across the load order.
+// The index is only unique within the plugin that first placed it.
+type refID struct {
+	plugin string
+	index  uint32
+}
+
+// destination is where a door or travel service teleports to.
+type destination struct {
+	X, Y, Z float32
+	// Cell is the interior cell name, or empty for exteriors.
+	Cell string
+}
+
+// cellRef is a reference placed in a cell.
+type cellRef struct {
+	id      refID
+	cell    *cellHeader
+	object  string
+	x, y, z float32
+	rotZ    float32
+	scale   float32
+	deleted bool
+	dest    *destination
+}
+
+// cellKey is the grid coordinate of the exterior cell the
+// reference is positioned in.
+func (r *cellRef) cellKey() uint64 {
+	return coordKey(worldToCell(r.x), worldToCell(r.y))
+}
+
+func worldToCell(v float32) int32 {
+	return int32(math.Floor(float64(v) / cellUnits))
+}
+
+// parseMasters reads the list of masters from a TES3 header.
+func parseMasters(rec *esm.Record) []string {
+	out := []string{}
+	for _, sub := range rec.Subrecords {
+		if sub.Tag == tes3.MAST {
+			out = append(out, strings.ToLower(filepath.Base(zstring(sub.Data))))
+		}
+	}
+	return out
+}
+
+// parseCellRefs reads the references out of a CELL record.
+// masters is the master list of the plugin the record came from,
+// which is needed to work out which plugin first placed each reference.
+func parseCellRefs(rec *esm.Record, header *cellHeader, masters []string) ([]*cellRef, error) {
+	out := []*cellRef{}
+	var current *cellRef
+	for _, sub := range rec.Subrecords {
+		switch sub.Tag {
+		case cell.FRMR:
+			if len(sub.Data) < 4 {
+				return nil, fmt.Errorf("CELL.FRMR too short: %d < 4", len(sub.Data))
+			}
+			raw := binary.LittleEndian.Uint32(sub.Data)
+			id := refID{plugin: rec.PluginName, index: raw & 0x00ffffff}
+			// https://github.com/OpenMW/openmw/blob/master/components/esm3/esmreader.cpp
+			if local := raw >> 24; local > 0 && int(local) <= len(masters) {
+				id.plugin = masters[local-1]
+			}
+			// Moved references are still listed under their original
+			// cell, but their position is up to date.
+			current = &cellRef{id: id, cell: header, scale: 1}
+			out = append(out, current)
+		case objNAME:
+			if current != nil {
+				current.object = strings.ToLower(zstring(sub.Data))
+			}
+		case cell.XSCL:
+			if current != nil && len(sub.Data) >= 4 {
+				current.scale = math.Float32frombits(binary.LittleEndian.Uint32(sub.Data))
+			}
+		case refDELE:
+			if current != nil {
+				current.deleted = true
+			}
+		case cell.DODT:
+			if current != nil && len(sub.Data) >= 24 {
+				dest := cell.DODTField{}
+				if err := dest.Unmarshal(sub); err != nil {
+					return nil, fmt.Errorf("parse CELL.DODT: %w", err)
+				}
+				current.dest = &destination{X: dest.PosX, Y: dest.PosY, Z: dest.PosZ}
+			}
+		case refDNAM:
+			if current != nil && current.dest != nil {
+				current.dest.Cell = zstring(sub.Data)
+			}
+		case cell.DATA:
+			if current == nil {
+				continue
+			}
+			if len(sub.Data) < 24 {
+				return nil, fmt.Errorf("CELL.DATA reference position too short: %d < 24", len(sub.Data))
+			}
+			pos := cell.DATAFormReferenceField{}
+			if err := pos.Unmarshal(sub); err != nil {
+				return nil, fmt.Errorf("parse reference position: %w", err)
+			}
+			current.x, current.y, current.z = pos.PosX, pos.PosY, pos.PosZ
+			current.rotZ = pos.RotZ
+		}
+	}
+	return out, nil
+}
+
+// addCell records the references in a CELL record. Records come
+// newest first, so the first version of each reference wins.
+func (l *LandParser) addCell(rec *esm.Record, header *cellHeader) error {
+	refs, err := parseCellRefs(rec, header, l.masters[rec.PluginName])
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if _, ok := l.refs[ref.id]; !ok {
+			l.refs[ref.id] = ref
+		}
+	}
+	return nil
+}
+
+// liveRefs returns every reference that hasn't been deleted, in a
+// stable order.
+func (l *LandParser) liveRefs() []*cellRef {
+	out := make([]*cellRef, 0, len(l.refs))
+	for _, ref := range l.refs {
+		if !ref.deleted {
+			out = append(out, ref)
+		}
+	}
+	slices.SortFunc(out, func(a, b *cellRef) int {
+		return cmp.Or(cmp.Compare(a.id.plugin, b.id.plugin), cmp.Compare(a.id.index, b.id.index))
+	})
+	return out
+}
+
+// exteriorRefs returns live references placed in exterior cells.
+func (l *LandParser) exteriorRefs() []*cellRef {
+	return slices.DeleteFunc(l.liveRefs(), func(ref *cellRef) bool {
+		return ref.cell.interior
+	})
+}
+
+// submapsContaining lists the submaps that contain a cell.
+func submapsContaining(submaps []SubmapNode, x, y int32) []SubmapID {
+	out := []SubmapID{}
+	for _, s := range submaps {
+		if !s.Extents.NotContainsPoint(x, y) {
+			out = append(out, s.ID)
+		}
+	}
+	slices.Sort(out)
+	return out
+}
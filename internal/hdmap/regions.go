@@ -0,0 +1,234 @@
+package hdmap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"strings"
+
+	"github.com/erinpentecost/LivelyMap/internal/hue"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+)
+
+// REGN records define regions.
+// https://en.uesp.net/wiki/Morrowind_Mod:Mod_File_Format/REGN
+const REGN esm.RecordTag = "REGN"
+
+const (
+	regnNAME esm.SubrecordTag = "NAME"
+	regnFNAM esm.SubrecordTag = "FNAM"
+	regnCNAM esm.SubrecordTag = "CNAM"
+)
+
+// cellFlagInterior is set in CELL.DATA for interior cells.
+const cellFlagInterior = 0x01
+
+// regionTint is how strongly region colors are blended over terrain.
+const regionTint = 0.35
+
+// zstring reads a string that may or may not be null-terminated.
+func zstring(data []byte) string {
+	if i := bytes.IndexByte(data, 0); i >= 0 {
+		return string(data[:i])
+	}
+	return string(data)
+}
+
+// Region is a named area of the exterior world.
+type Region struct {
+	ID    string
+	Name  string
+	Color color.RGBA
+}
+
+func parseRegion(rec *esm.Record) (*Region, error) {
+	out := &Region{}
+	for _, sub := range rec.Subrecords {
+		switch sub.Tag {
+		case regnNAME:
+			out.ID = zstring(sub.Data)
+		case regnFNAM:
+			out.Name = zstring(sub.Data)
+		case regnCNAM:
+			if len(sub.Data) < 3 {
+				return nil, fmt.Errorf("REGN.CNAM too short: %d < 3", len(sub.Data))
+			}
+			out.Color = color.RGBA{R: sub.Data[0], G: sub.Data[1], B: sub.Data[2], A: math.MaxUint8}
+		}
+	}
+	if len(out.ID) == 0 {
+		return nil, fmt.Errorf("REGN has no NAME")
+	}
+	return out, nil
+}
+
+// regionID normalizes region IDs, which are case-insensitive.
+func regionID(id string) string {
+	return strings.ToLower(id)
+}
+
+// cellHeader is the part of a CELL record that comes before
+// its references.
+type cellHeader struct {
+	name     string
+	flags    uint32
+	x        int32
+	y        int32
+	region   string
+	interior bool
+}
+
+func parseCellHeader(rec *esm.Record) (*cellHeader, error) {
+	out := &cellHeader{}
+	for _, sub := range rec.Subrecords {
+		switch sub.Tag {
+		case cell.NAME:
+			out.name = zstring(sub.Data)
+		case cell.DATA:
+			if len(sub.Data) < 12 {
+				return nil, fmt.Errorf("CELL.DATA too short: %d < 12", len(sub.Data))
+			}
+			out.flags = binary.LittleEndian.Uint32(sub.Data[0:4])
+			out.x = int32(binary.LittleEndian.Uint32(sub.Data[4:8]))
+			out.y = int32(binary.LittleEndian.Uint32(sub.Data[8:12]))
+			out.interior = out.flags&cellFlagInterior != 0
+		case cell.RGNN:
+			out.region = regionID(zstring(sub.Data))
+		case cell.FRMR, cell.MVRF:
+			// references start here
+			return out, nil
+		}
+	}
+	return out, nil
+}
+
+// RegionInfo is the summary of a region that goes in maps.json.
+type RegionInfo struct {
+	Name  string
+	Color string
+	// Cells is the number of exterior cells in the region.
+	Cells int
+	// CenterX and CenterY are the average cell coordinates of the
+	// region, which is a decent place to put a label.
+	CenterX float64
+	CenterY float64
+}
+
+// RegionTable summarizes every region that has at least one cell.
+func (l *LandParser) RegionTable() map[string]*RegionInfo {
+	out := map[string]*RegionInfo{}
+	for _, c := range l.cells {
+		region, ok := l.Regions[c.region]
+		if !ok {
+			continue
+		}
+		info, ok := out[c.region]
+		if !ok {
+			info = &RegionInfo{
+				Name:  region.Name,
+				Color: fmt.Sprintf("#%02x%02x%02x", region.Color.R, region.Color.G, region.Color.B),
+			}
+			out[c.region] = info
+		}
+		info.Cells++
+		info.CenterX += float64(c.x)
+		info.CenterY += float64(c.y)
+	}
+	for _, info := range out {
+		info.CenterX /= float64(info.Cells)
+		info.CenterY /= float64(info.Cells)
+	}
+	return out
+}
+
+// CellRegions maps "x,y" cell keys to region IDs.
+func (l *LandParser) CellRegions() map[string]string {
+	out := map[string]string{}
+	for _, c := range l.cells {
+		if _, ok := l.Regions[c.region]; ok {
+			out[fmt.Sprintf("%d,%d", c.x, c.y)] = c.region
+		}
+	}
+	return out
+}
+
+// RegionRenderer draws region colors, with a dark line where two
+// regions meet. If Base is set, regions are tinted over it. Otherwise,
+// the output is a transparent overlay.
+type RegionRenderer struct {
+	Base    CellRenderer
+	regions map[string]*Region
+	cells   map[uint64]*cellHeader
+}
+
+func NewRegionRenderer(lp *LandParser, base CellRenderer) *RegionRenderer {
+	return &RegionRenderer{
+		Base:    base,
+		regions: lp.Regions,
+		cells:   lp.cells,
+	}
+}
+
+func (d *RegionRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	if d.Base != nil {
+		d.Base.SetHeightExtents(heightStats, waterHeight)
+	}
+}
+
+func (d *RegionRenderer) region(x, y int32) *Region {
+	c, ok := d.cells[coordKey(x, y)]
+	if !ok {
+		return nil
+	}
+	return d.regions[c.region]
+}
+
+func (d *RegionRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	var img *image.RGBA
+	if d.Base != nil {
+		img = d.Base.Render(p)
+	} else {
+		img = image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	}
+
+	region := d.region(p.x, p.y)
+	if region == nil {
+		return img
+	}
+	// Borders are drawn on edges shared with a different region.
+	westBorder := d.region(p.x-1, p.y) != region
+	eastBorder := d.region(p.x+1, p.y) != region
+	northBorder := d.region(p.x, p.y+1) != region
+	southBorder := d.region(p.x, p.y-1) != region
+	border := hue.MulColor(region.Color, color.Gray{Y: 0x40})
+
+	for y := range gridSize {
+		for x := range gridSize {
+			onBorder := (westBorder && x == 0) || (eastBorder && x == gridSize-1) ||
+				(northBorder && y == 0) || (southBorder && y == gridSize-1)
+			switch {
+			case onBorder:
+				img.SetRGBA(x, y, border)
+			case d.Base != nil:
+				img.SetRGBA(x, y, blend(img.RGBAAt(x, y), region.Color, regionTint))
+			default:
+				c := region.Color
+				c.A = uint8(math.Round(regionTint * math.MaxUint8))
+				img.SetRGBA(x, y, c)
+			}
+		}
+	}
+	return img
+}
+
+// blend mixes b into a by the given amount, keeping a's alpha.
+func blend(a, b color.RGBA, amount float64) color.RGBA {
+	mix := func(x, y uint8) uint8 {
+		return uint8(math.Round(float64(x)*(1-amount) + float64(y)*amount))
+	}
+	return color.RGBA{R: mix(a.R, b.R), G: mix(a.G, b.G), B: mix(a.B, b.B), A: a.A}
+}
@@ -0,0 +1,113 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"image/color"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+	"github.com/stretchr/testify/require"
+)
+
+// zdata makes a null-terminated string.
+func zdata(s string) []byte {
+	return append([]byte(s), 0)
+}
+
+// cellRecord makes an exterior CELL record for x,y. Extra subrecords,
+// like references, are added after the header.
+func cellRecord(name string, x, y int32, region string, subs ...*esm.Subrecord) *esm.Record {
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint32(data[4:8], uint32(x))
+	binary.LittleEndian.PutUint32(data[8:12], uint32(y))
+	rec := &esm.Record{
+		Tag: cell.CELL,
+		Subrecords: []*esm.Subrecord{
+			{Tag: cell.NAME, Data: zdata(name)},
+			{Tag: cell.DATA, Data: data},
+		},
+	}
+	if len(region) > 0 {
+		rec.Subrecords = append(rec.Subrecords, &esm.Subrecord{Tag: cell.RGNN, Data: zdata(region)})
+	}
+	rec.Subrecords = append(rec.Subrecords, subs...)
+	return rec
+}
+
+func regionRecord(id, name string, c color.RGBA) *esm.Record {
+	return &esm.Record{
+		Tag: REGN,
+		Subrecords: []*esm.Subrecord{
+			{Tag: regnNAME, Data: zdata(id)},
+			{Tag: regnFNAM, Data: zdata(name)},
+			{Tag: regnCNAM, Data: []byte{c.R, c.G, c.B, 0}},
+		},
+	}
+}
+
+func TestRegions(t *testing.T) {
+	dir := t.TempDir()
+	red := color.RGBA{R: 200, A: 255}
+	blue := color.RGBA{B: 200, A: 255}
+	master := writePlugin(t, dir, "Master.esm",
+		regionRecord("Ashlands Region", "Ashlands", red),
+		regionRecord("Bitter Coast Region", "Bitter Coast", blue),
+		cellRecord("", 0, 0, "Ashlands Region"),
+		cellRecord("", 1, 0, "Ashlands Region"),
+		cellRecord("", 2, 0, "Ashlands Region"),
+		landRecord(0, 0, 1), landRecord(1, 0, 1), landRecord(2, 0, 1),
+	)
+	// the patch moves a cell into a different region
+	patch := writePlugin(t, dir, "Patch.esp",
+		cellRecord("", 2, 0, "bitter coast region"),
+	)
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master, patch}})
+	require.NoError(t, lp.ParsePlugins())
+	require.Len(t, lp.Regions, 2)
+
+	table := lp.RegionTable()
+	require.Equal(t, &RegionInfo{Name: "Ashlands", Color: "#c80000", Cells: 2, CenterX: 0.5}, table["ashlands region"])
+	require.Equal(t, &RegionInfo{Name: "Bitter Coast", Color: "#0000c8", Cells: 1, CenterX: 2}, table["bitter coast region"])
+	require.Equal(t, "bitter coast region", lp.CellRegions()["2,0"])
+
+	renderer := NewRegionRenderer(lp, nil)
+	for _, p := range lp.Lands {
+		if p.fake || p.x != 1 {
+			continue
+		}
+		img := renderer.Render(p)
+		center := img.RGBAAt(gridSize/2, gridSize/2)
+		require.Equal(t, red.R, center.R)
+		require.Less(t, center.A, uint8(255))
+		// border with the bitter coast
+		require.Equal(t, uint8(255), img.RGBAAt(gridSize-1, gridSize/2).A)
+		// no border with the rest of the ashlands
+		require.Less(t, img.RGBAAt(0, gridSize/2).A, uint8(255))
+	}
+}
+
+func TestParsePluginsSkipsBadRecords(t *testing.T) {
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm",
+		regionRecord("Ashlands Region", "Ashlands", color.RGBA{R: 200, A: 255}),
+		// no NAME
+		&esm.Record{Tag: REGN, Subrecords: []*esm.Subrecord{{Tag: regnFNAM, Data: zdata("Broken")}}},
+		// DATA is too short
+		&esm.Record{Tag: cell.CELL, Subrecords: []*esm.Subrecord{{Tag: cell.DATA, Data: []byte{0}}}},
+		// no NAME
+		&esm.Record{Tag: STAT},
+		cellRecord("", 0, 0, "Ashlands Region"),
+		// the reference is broken, but the cell is still good
+		cellRecord("", 1, 0, "Ashlands Region", &esm.Subrecord{Tag: cell.FRMR, Data: []byte{1}}),
+		landRecord(0, 0, 1), landRecord(1, 0, 1),
+	)
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+	require.Len(t, lp.Regions, 1)
+	require.Equal(t, "ashlands region", lp.CellRegions()["0,0"])
+	require.Equal(t, "ashlands region", lp.CellRegions()["1,0"])
+}
@@ -0,0 +1,317 @@
+package hdmap
+
+import (
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"regexp"
+
+	"github.com/erinpentecost/LivelyMap/internal/geojson"
+)
+
+const (
+	// patchesPerCell is the number of texture patches along a cell edge.
+	patchesPerCell = 16
+	// patchUnits is the width of a texture patch in world units.
+	patchUnits = cellUnits / patchesPerCell
+)
+
+// defaultRoadPattern matches the road textures in the base game and
+// most landmass mods.
+const defaultRoadPattern = `road|cobble|pavement`
+
+// roadWidth is the stroke width of roads, in pixels.
+const roadWidth = 1.5
+
+var roadColor = color.RGBA{R: 0x4a, G: 0x3a, B: 0x28, A: 0xff}
+
+// Road is a polyline along the middle of a road, in world units.
+type Road struct {
+	Points [][2]float64
+}
+
+// Length is the length of the road in world units.
+func (r *Road) Length() float64 {
+	total := 0.0
+	for i := 1; i < len(r.Points); i++ {
+		total += math.Hypot(r.Points[i][0]-r.Points[i-1][0], r.Points[i][1]-r.Points[i-1][1])
+	}
+	return total
+}
+
+// RoadPattern compiles a road texture pattern, which is a
+// case-insensitive regular expression matched against the LTEX ID
+// and texture path. "default" uses the built-in pattern.
+func RoadPattern(pattern string) (*regexp.Regexp, error) {
+	if pattern == "default" {
+		pattern = defaultRoadPattern
+	}
+	re, err := regexp.Compile("(?i)" + pattern)
+	if err != nil {
+		return nil, fmt.Errorf("bad road pattern %q: %w", pattern, err)
+	}
+	return re, nil
+}
+
+// patchGrid is a grid of texture patches over the whole map.
+// y grows to the north.
+type patchGrid struct {
+	// left and bottom are the global patch coordinates of 0,0.
+	left   int32
+	bottom int32
+	width  int
+	height int
+	set    []bool
+}
+
+func newPatchGrid(extents MapCoords) *patchGrid {
+	// A border of empty patches keeps thinning simple.
+	g := &patchGrid{
+		left:   extents.Left*patchesPerCell - 1,
+		bottom: extents.Bottom*patchesPerCell - 1,
+		width:  int(extents.Width())*patchesPerCell + 2,
+		height: int(extents.Height())*patchesPerCell + 2,
+	}
+	g.set = make([]bool, g.width*g.height)
+	return g
+}
+
+func (g *patchGrid) at(x, y int) bool {
+	if x < 0 || y < 0 || x >= g.width || y >= g.height {
+		return false
+	}
+	return g.set[y*g.width+x]
+}
+
+// world is the world position of the center of a patch.
+func (g *patchGrid) world(x, y int) [2]float64 {
+	return [2]float64{
+		(float64(g.left) + float64(x) + 0.5) * patchUnits,
+		(float64(g.bottom) + float64(y) + 0.5) * patchUnits,
+	}
+}
+
+// roadGrid marks every texture patch that has a road texture.
+func (l *LandParser) roadGrid(pattern *regexp.Regexp) *patchGrid {
+	roads := map[uint16]bool{}
+	for idx, name := range l.TextureNames {
+		if pattern.MatchString(name.ID) || pattern.MatchString(name.Path) {
+			roads[idx] = true
+		}
+	}
+	g := newPatchGrid(l.MapExtents)
+	for _, p := range l.Lands {
+		if p.fake {
+			continue
+		}
+		for row := range patchesPerCell {
+			for col := range patchesPerCell {
+				if tex, ok := p.textureAt(row, col); ok && roads[tex] {
+					x := int(p.x*patchesPerCell + int32(col) - g.left)
+					y := int(p.y*patchesPerCell + int32(row) - g.bottom)
+					if x >= 0 && y >= 0 && x < g.width && y < g.height {
+						g.set[y*g.width+x] = true
+					}
+				}
+			}
+		}
+	}
+	return g
+}
+
+// thin skeletonizes the grid in place with the Zhang–Suen algorithm,
+// leaving lines one patch wide.
+func (g *patchGrid) thin() {
+	b := func(x, y int) int {
+		if g.at(x, y) {
+			return 1
+		}
+		return 0
+	}
+	for changed := true; changed; {
+		changed = false
+		for step := range 2 {
+			remove := []int{}
+			for y := 1; y < g.height-1; y++ {
+				for x := 1; x < g.width-1; x++ {
+					if !g.at(x, y) {
+						continue
+					}
+					// P2 through P9, clockwise from north.
+					n := [8]int{
+						b(x, y+1), b(x+1, y+1), b(x+1, y), b(x+1, y-1),
+						b(x, y-1), b(x-1, y-1), b(x-1, y), b(x-1, y+1),
+					}
+					count, transitions := 0, 0
+					for i := range n {
+						count += n[i]
+						if n[i] == 0 && n[(i+1)%8] == 1 {
+							transitions++
+						}
+					}
+					if count < 2 || count > 6 || transitions != 1 {
+						continue
+					}
+					p2, p4, p6, p8 := n[0], n[2], n[4], n[6]
+					if step == 0 && (p2*p4*p6 != 0 || p4*p6*p8 != 0) {
+						continue
+					}
+					if step == 1 && (p2*p4*p8 != 0 || p2*p6*p8 != 0) {
+						continue
+					}
+					remove = append(remove, y*g.width+x)
+				}
+			}
+			for _, i := range remove {
+				g.set[i] = false
+			}
+			changed = changed || len(remove) > 0
+		}
+	}
+}
+
+// neighbors lists the set neighbors of a patch. Diagonal neighbors
+// are skipped when a shared orthogonal neighbor already connects them,
+// so corners don't look like junctions.
+func (g *patchGrid) neighbors(x, y int) [][2]int {
+	out := [][2]int{}
+	for _, d := range [][2]int{{0, 1}, {1, 0}, {0, -1}, {-1, 0}} {
+		if g.at(x+d[0], y+d[1]) {
+			out = append(out, [2]int{x + d[0], y + d[1]})
+		}
+	}
+	for _, d := range [][2]int{{1, 1}, {1, -1}, {-1, -1}, {-1, 1}} {
+		if g.at(x+d[0], y+d[1]) && !g.at(x+d[0], y) && !g.at(x, y+d[1]) {
+			out = append(out, [2]int{x + d[0], y + d[1]})
+		}
+	}
+	return out
+}
+
+// trace follows a skeleton into polylines that run between
+// junctions and dead ends. Loops become closed polylines.
+func (g *patchGrid) trace() [][][2]int {
+	type edge struct{ a, b [2]int }
+	visited := map[edge]bool{}
+	seen := func(a, b [2]int) bool { return visited[edge{a, b}] }
+	mark := func(a, b [2]int) {
+		visited[edge{a, b}] = true
+		visited[edge{b, a}] = true
+	}
+	walk := func(start, next [2]int) [][2]int {
+		line := [][2]int{start}
+		prev, cur := start, next
+		mark(prev, cur)
+		for {
+			line = append(line, cur)
+			ns := g.neighbors(cur[0], cur[1])
+			if len(ns) != 2 {
+				return line
+			}
+			found := false
+			for _, n := range ns {
+				if n != prev && !seen(cur, n) {
+					mark(cur, n)
+					prev, cur = cur, n
+					found = true
+					break
+				}
+			}
+			if !found {
+				return line
+			}
+		}
+	}
+
+	out := [][][2]int{}
+	// Start from the ends and junctions first, then pick up loops.
+	for _, loops := range []bool{false, true} {
+		for y := range g.height {
+			for x := range g.width {
+				if !g.at(x, y) {
+					continue
+				}
+				p := [2]int{x, y}
+				ns := g.neighbors(x, y)
+				if (len(ns) == 2) != loops {
+					continue
+				}
+				for _, n := range ns {
+					if !seen(p, n) {
+						out = append(out, walk(p, n))
+					}
+				}
+			}
+		}
+	}
+	return out
+}
+
+// Roads finds the road network from road land textures.
+func (l *LandParser) Roads(pattern *regexp.Regexp) []*Road {
+	g := l.roadGrid(pattern)
+	g.thin()
+	out := []*Road{}
+	for _, line := range g.trace() {
+		points := make([][2]float64, 0, len(line))
+		for _, p := range line {
+			points = append(points, g.world(p[0], p[1]))
+		}
+		out = append(out, &Road{Points: simplifyLine(points, patchUnits/2)})
+	}
+	return out
+}
+
+// RoadsGeoJSON turns roads into a GeoJSON feature collection.
+func RoadsGeoJSON(roads []*Road) *geojson.FeatureCollection {
+	out := geojson.NewFeatureCollection()
+	for _, road := range roads {
+		out.Add(geojson.NewFeature(geojson.LineString(road.Points), map[string]any{
+			"length": math.Round(road.Length()),
+		}))
+	}
+	return out
+}
+
+// RoadRenderer strokes roads over another renderer.
+type RoadRenderer struct {
+	Base CellRenderer
+	// segments are the road segments that touch each cell.
+	segments map[uint64][][2][2]float64
+}
+
+func NewRoadRenderer(roads []*Road, base CellRenderer) *RoadRenderer {
+	segments := map[uint64][][2][2]float64{}
+	// Strokes can hang over into the next cell.
+	pad := roadWidth * cellUnits / gridSize
+	for _, road := range roads {
+		for i := 1; i < len(road.Points); i++ {
+			a, b := road.Points[i-1], road.Points[i]
+			minX := worldToCell(float32(min(a[0], b[0]) - pad))
+			maxX := worldToCell(float32(max(a[0], b[0]) + pad))
+			minY := worldToCell(float32(min(a[1], b[1]) - pad))
+			maxY := worldToCell(float32(max(a[1], b[1]) + pad))
+			for x := minX; x <= maxX; x++ {
+				for y := minY; y <= maxY; y++ {
+					segments[coordKey(x, y)] = append(segments[coordKey(x, y)], [2][2]float64{a, b})
+				}
+			}
+		}
+	}
+	return &RoadRenderer{Base: base, segments: segments}
+}
+
+func (d *RoadRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	d.Base.SetHeightExtents(heightStats, waterHeight)
+}
+
+func (d *RoadRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := d.Base.Render(p)
+	for _, seg := range d.segments[coordKey(p.x, p.y)] {
+		x0, y0 := cellPixel(p.x, p.y, float32(seg[0][0]), float32(seg[0][1]))
+		x1, y1 := cellPixel(p.x, p.y, float32(seg[1][0]), float32(seg[1][1]))
+		drawSegment(img, x0, y0, x1, y1, roadWidth, roadColor)
+	}
+	return img
+}
@@ -0,0 +1,88 @@
+package hdmap
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSimplifyLine(t *testing.T) {
+	line := [][2]float64{{0, 0}, {1, 0.1}, {2, -0.1}, {3, 0}, {3, 5}}
+	require.Equal(t, [][2]float64{{0, 0}, {3, 0}, {3, 5}}, simplifyLine(line, 0.5))
+	require.Equal(t, line, simplifyLine(line, 0.01))
+}
+
+func TestRoads(t *testing.T) {
+	dir := t.TempDir()
+	// A road three patches wide runs east along rows 6-8 of two cells,
+	// then turns north in the second cell.
+	road := func(x int32) func(row, col int) uint16 {
+		return func(row, col int) uint16 {
+			if row >= 6 && row <= 8 {
+				return 2
+			}
+			if x == 1 && col >= 6 && col <= 8 && row > 8 {
+				return 2
+			}
+			return 1
+		}
+	}
+	master := writePlugin(t, dir, "Master.esm",
+		ltexRecord("AI Grass 01", 0, `tx_ai_grass_01.tga`),
+		ltexRecord("Road Dirt", 1, `tx_road_dirt.tga`),
+		withTextures(landRecord(0, 0, 1), road(0)),
+		withTextures(landRecord(1, 0, 1), road(1)),
+	)
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+
+	pattern, err := RoadPattern("default")
+	require.NoError(t, err)
+	roads := lp.Roads(pattern)
+	require.NotEmpty(t, roads)
+
+	// Everything should be near the middle of the road.
+	total := 0.0
+	for _, road := range roads {
+		total += road.Length()
+		for _, p := range road.Points {
+			onEastWest := p[1] > 6*patchUnits && p[1] < 9*patchUnits
+			onNorthSouth := p[0] > cellUnits+6*patchUnits && p[0] < cellUnits+9*patchUnits
+			require.True(t, onEastWest || onNorthSouth, "%v is off the road", p)
+		}
+	}
+	// The east-west part is almost two cells long, and the north-south
+	// part is about half a cell.
+	require.Greater(t, total, 2.0*cellUnits)
+	require.Less(t, total, 3.0*cellUnits)
+
+	path := filepath.Join(dir, "roads.geojson")
+	require.NoError(t, RoadsGeoJSON(roads).Write(path))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	parsed := map[string]any{}
+	require.NoError(t, json.Unmarshal(raw, &parsed))
+	require.Equal(t, "FeatureCollection", parsed["type"])
+	require.Len(t, parsed["features"], len(roads))
+
+	// Roads are drawn over the base renderer.
+	renderer := NewRoadRenderer(roads, NewBiomeRenderer(mustBiomeRules(t), lp.TextureNames))
+	for _, p := range lp.Lands {
+		if p.x == 0 && p.y == 0 && !p.fake {
+			img := renderer.Render(p)
+			// row 7.5 of 16 is pixel 30 from the bottom
+			require.Equal(t, roadColor, img.RGBAAt(gridSize/2, gridSize-31))
+			require.NotEqual(t, roadColor, img.RGBAAt(gridSize/2, 2))
+		}
+	}
+}
+
+func mustBiomeRules(t *testing.T) *BiomeRules {
+	rules, err := LoadBiomeRules("default")
+	require.NoError(t, err)
+	return rules
+}
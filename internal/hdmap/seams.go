@@ -0,0 +1,241 @@
+package hdmap
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"os"
+	"slices"
+
+	"github.com/ernmw/omwpacker/esm/record/land"
+)
+
+// seamBlendWidth is how many vertices into each cell a seam correction
+// is spread over.
+const seamBlendWidth = 8
+
+// Seam is a mismatch along the shared edge of two neighboring cells.
+// A is always the west or south cell, and B is the east or north cell.
+type Seam struct {
+	AX      int32
+	AY      int32
+	APlugin string
+	BX      int32
+	BY      int32
+	BPlugin string
+	Edge    Direction
+	// MaxHeightDelta is the largest height difference between
+	// two vertices that should be identical.
+	MaxHeightDelta float32
+	// MaxNormalDelta is the largest angle, in degrees, between
+	// two normals that should be identical.
+	MaxNormalDelta float64
+
+	a *ParsedLandRecord
+	b *ParsedLandRecord
+}
+
+func (s *Seam) String() string {
+	return fmt.Sprintf("%d,%d (%s) / %d,%d (%s): height %.1f, normal %.1f°",
+		s.AX, s.AY, s.APlugin,
+		s.BX, s.BY, s.BPlugin,
+		s.MaxHeightDelta, s.MaxNormalDelta)
+}
+
+// vertex returns the indices of the i'th vertex along the seam, offset
+// vertices into each cell.
+func (s *Seam) vertex(i int, offset int) (aRow, aCol, bRow, bCol int) {
+	if s.Edge == East {
+		return i, gridSize - offset, i, offset
+	}
+	return gridSize - offset, i, offset, i
+}
+
+// FindSeams compares the shared edges of every pair of neighboring
+// real cells. Pairs with a height or normal mismatch larger than the
+// tolerances are returned.
+func (l *LandParser) FindSeams(heightTolerance float32, normalTolerance float64) []*Seam {
+	real := map[uint64]*ParsedLandRecord{}
+	for _, p := range l.Lands {
+		if !p.fake {
+			real[coordKey(p.x, p.y)] = p
+		}
+	}
+
+	seams := []*Seam{}
+	for _, a := range l.Lands {
+		if a.fake {
+			continue
+		}
+		for _, dir := range []Direction{East, North} {
+			bx, by := a.x, a.y
+			if dir == East {
+				bx++
+			} else {
+				by++
+			}
+			b, ok := real[coordKey(bx, by)]
+			if !ok {
+				continue
+			}
+			seam := &Seam{
+				AX:      a.x,
+				AY:      a.y,
+				APlugin: a.plugin,
+				BX:      b.x,
+				BY:      b.y,
+				BPlugin: b.plugin,
+				Edge:    dir,
+				a:       a,
+				b:       b,
+			}
+			for i := range cellVertices {
+				aRow, aCol, bRow, bCol := seam.vertex(i, 0)
+				delta := a.heights[aRow][aCol] - b.heights[bRow][bCol]
+				seam.MaxHeightDelta = max(seam.MaxHeightDelta, float32(math.Abs(float64(delta))))
+				seam.MaxNormalDelta = max(seam.MaxNormalDelta,
+					normalAngle(a.normals[aRow][aCol], b.normals[bRow][bCol]))
+			}
+			if seam.MaxHeightDelta > heightTolerance || seam.MaxNormalDelta > normalTolerance {
+				seams = append(seams, seam)
+			}
+		}
+	}
+
+	slices.SortFunc(seams, func(a, b *Seam) int {
+		if a.MaxHeightDelta > b.MaxHeightDelta {
+			return -1
+		} else if a.MaxHeightDelta < b.MaxHeightDelta {
+			return 1
+		}
+		return 0
+	})
+	return seams
+}
+
+// normalAngle returns the angle between two normals, in degrees.
+func normalAngle(a, b land.VertexField) float64 {
+	ax, ay, az := float64(a.X), float64(a.Y), float64(a.Z)
+	bx, by, bz := float64(b.X), float64(b.Y), float64(b.Z)
+	la := math.Sqrt(ax*ax + ay*ay + az*az)
+	lb := math.Sqrt(bx*bx + by*by + bz*bz)
+	if la == 0 || lb == 0 {
+		return 0
+	}
+	cos := (ax*bx + ay*by + az*bz) / (la * lb)
+	return math.Acos(min(1, max(-1, cos))) * 180 / math.Pi
+}
+
+// BlendSeams meets each seam in the middle. The height correction
+// fades out over a few vertices on each side, and the normals on the
+// shared edge are averaged. The corners at the ends of a seam can be
+// shared by up to four of lands, so they're blended once each, after
+// the edges, and aren't faded.
+func BlendSeams(lands []*ParsedLandRecord, seams []*Seam) {
+	for _, s := range seams {
+		s.a.ownNormals()
+		s.b.ownNormals()
+		for i := 1; i < gridSize; i++ {
+			aRow, aCol, bRow, bCol := s.vertex(i, 0)
+			ha := s.a.heights[aRow][aCol]
+			hb := s.b.heights[bRow][bCol]
+			mid := (ha + hb) / 2
+			for offset := range seamBlendWidth {
+				weight := 1 - float32(offset)/seamBlendWidth
+				ar, ac, br, bc := s.vertex(i, offset)
+				s.a.heights[ar][ac] += (mid - ha) * weight
+				s.b.heights[br][bc] += (mid - hb) * weight
+			}
+
+			na := s.a.normals[aRow][aCol]
+			nb := s.b.normals[bRow][bCol]
+			avg := averageNormal(na, nb)
+			s.a.normals[aRow][aCol] = avg
+			s.b.normals[bRow][bCol] = avg
+		}
+	}
+
+	real := map[uint64]*ParsedLandRecord{}
+	for _, p := range lands {
+		if !p.fake {
+			real[coordKey(p.x, p.y)] = p
+		}
+	}
+	// Corners are keyed by the cell they're the southwest corner of.
+	corners := map[uint64][2]int32{}
+	for _, s := range seams {
+		// The ends of the seam are the corners of b on its edge.
+		corners[coordKey(s.BX, s.BY)] = [2]int32{s.BX, s.BY}
+		if s.Edge == East {
+			corners[coordKey(s.BX, s.BY+1)] = [2]int32{s.BX, s.BY + 1}
+		} else {
+			corners[coordKey(s.BX+1, s.BY)] = [2]int32{s.BX + 1, s.BY}
+		}
+	}
+	for _, corner := range corners {
+		type vertex struct {
+			p        *ParsedLandRecord
+			row, col int
+		}
+		shared := []vertex{}
+		for _, dx := range []int32{-1, 0} {
+			for _, dy := range []int32{-1, 0} {
+				if p, ok := real[coordKey(corner[0]+dx, corner[1]+dy)]; ok {
+					shared = append(shared, vertex{p: p, row: int(-dy) * gridSize, col: int(-dx) * gridSize})
+				}
+			}
+		}
+		sum := float32(0)
+		normals := make([]land.VertexField, 0, len(shared))
+		for _, v := range shared {
+			v.p.ownNormals()
+			sum += v.p.heights[v.row][v.col]
+			normals = append(normals, v.p.normals[v.row][v.col])
+		}
+		avg := averageNormal(normals...)
+		for _, v := range shared {
+			v.p.heights[v.row][v.col] = sum / float32(len(shared))
+			v.p.normals[v.row][v.col] = avg
+		}
+	}
+}
+
+// averageNormal is the normalized sum of normals.
+func averageNormal(normals ...land.VertexField) land.VertexField {
+	x, y, z := 0.0, 0.0, 0.0
+	for _, n := range normals {
+		x += float64(n.X)
+		y += float64(n.Y)
+		z += float64(n.Z)
+	}
+	length := math.Sqrt(x*x + y*y + z*z)
+	if length == 0 {
+		return normals[0]
+	}
+	return land.VertexField{
+		X: int8(math.Round(x / length * math.MaxInt8)),
+		Y: int8(math.Round(y / length * math.MaxInt8)),
+		Z: int8(math.Round(z / length * math.MaxInt8)),
+	}
+}
+
+// ownNormals makes sure p isn't sharing the fallback normals with
+// other records, so they can be edited.
+func (p *ParsedLandRecord) ownNormals() {
+	if len(p.normals) > 0 && len(fallbackNormals) > 0 && &p.normals[0] != &fallbackNormals[0] {
+		return
+	}
+	own := make([][]land.VertexField, len(fallbackNormals))
+	for i := range fallbackNormals {
+		own[i] = slices.Clone(fallbackNormals[i])
+	}
+	p.normals = own
+}
+
+func writeSeamReport(path string, seams []*Seam) error {
+	raw, err := json.MarshalIndent(seams, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal seam report: %w", err)
+	}
+	return os.WriteFile(path, raw, 0666)
+}
@@ -0,0 +1,62 @@
+package hdmap
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestFindSeams(t *testing.T) {
+	west := flatLand(0, 0, 100)
+	west.plugin = "a.esp"
+	east := flatLand(1, 0, 100)
+	east.plugin = "b.esp"
+	north := flatLand(0, 1, 100)
+	// the east cell was edited without its neighbor
+	east.heights[10][0] = 164
+
+	lp := &LandParser{Lands: []*ParsedLandRecord{west, east, north}}
+	seams := lp.FindSeams(8, 15)
+	require.Len(t, seams, 1)
+	require.Equal(t, East, seams[0].Edge)
+	require.Equal(t, int32(0), seams[0].AX)
+	require.Equal(t, int32(1), seams[0].BX)
+	require.Equal(t, "a.esp", seams[0].APlugin)
+	require.Equal(t, "b.esp", seams[0].BPlugin)
+	require.Equal(t, float32(64), seams[0].MaxHeightDelta)
+
+	BlendSeams(lp.Lands, seams)
+	require.Equal(t, west.heights[10][gridSize], east.heights[10][0])
+	require.Equal(t, float32(132), east.heights[10][0])
+	// the fix fades out away from the edge
+	require.Equal(t, float32(100), east.heights[10][seamBlendWidth])
+	require.Empty(t, lp.FindSeams(8, 15))
+}
+
+func TestBlendSeamCorners(t *testing.T) {
+	sw := flatLand(0, 0, 100)
+	se := flatLand(1, 0, 100)
+	nw := flatLand(0, 1, 100)
+	ne := flatLand(1, 1, 100)
+	// the whole west edge of the southeast cell was raised, so it
+	// has a seam with its west neighbor along the whole edge, and one
+	// with its north neighbor at the corner
+	for row := range cellVertices {
+		se.heights[row][0] = 164
+	}
+
+	lp := &LandParser{Lands: []*ParsedLandRecord{sw, se, nw, ne}}
+	seams := lp.FindSeams(8, 15)
+	require.Len(t, seams, 2)
+
+	BlendSeams(lp.Lands, seams)
+	// the shared corner is the average of all four cells
+	corner := []float32{sw.heights[gridSize][gridSize], se.heights[gridSize][0], nw.heights[0][gridSize], ne.heights[0][0]}
+	require.Equal(t, []float32{116, 116, 116, 116}, corner)
+	// the corner at the south end only has two
+	require.Equal(t, float32(132), se.heights[0][0])
+	require.Equal(t, float32(132), se.heights[10][0])
+	// the edges that meet at the corner are left alone
+	require.Equal(t, float32(100), se.heights[gridSize][1])
+	require.Empty(t, lp.FindSeams(8, 15))
+}
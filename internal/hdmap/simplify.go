@@ -0,0 +1,50 @@
+package hdmap
+
+import "math"
+
+// simplifyLine drops points from a polyline with the Douglas–Peucker
+// algorithm, so that no removed point is further than tolerance from
+// the simplified line. The first and last points are always kept.
+func simplifyLine(points [][2]float64, tolerance float64) [][2]float64 {
+	if len(points) < 3 {
+		return points
+	}
+	keep := make([]bool, len(points))
+	keep[0], keep[len(points)-1] = true, true
+	var visit func(first, last int)
+	visit = func(first, last int) {
+		farthest, distance := -1, tolerance
+		for i := first + 1; i < last; i++ {
+			if d := segmentDistance(points[i], points[first], points[last]); d > distance {
+				farthest, distance = i, d
+			}
+		}
+		if farthest < 0 {
+			return
+		}
+		keep[farthest] = true
+		visit(first, farthest)
+		visit(farthest, last)
+	}
+	visit(0, len(points)-1)
+
+	out := make([][2]float64, 0, len(points))
+	for i, p := range points {
+		if keep[i] {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// segmentDistance is the distance from p to the segment a-b.
+func segmentDistance(p, a, b [2]float64) float64 {
+	dx, dy := b[0]-a[0], b[1]-a[1]
+	lengthSquared := dx*dx + dy*dy
+	if lengthSquared == 0 {
+		return math.Hypot(p[0]-a[0], p[1]-a[1])
+	}
+	t := ((p[0]-a[0])*dx + (p[1]-a[1])*dy) / lengthSquared
+	t = max(0, min(1, t))
+	return math.Hypot(p[0]-(a[0]+t*dx), p[1]-(a[1]+t*dy))
+}
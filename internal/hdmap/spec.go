@@ -9,6 +9,9 @@ import (
 )
 
 type SpecularRenderer struct {
+	// Water, if set, gives each class of water its own specular
+	// strength. Otherwise, all water is treated like the ocean.
+	Water       *WaterMap
 	waterHeight float32
 	ramp        [256]color.RGBA
 }
@@ -17,6 +20,15 @@ func NewSpecularRenderer() (*SpecularRenderer, error) {
 	return &SpecularRenderer{}, nil
 }
 
+// withoutWater is a copy of d that treats all water like the ocean.
+// Records that aren't real cells, like the sky's, have no water class
+// of their own.
+func (d *SpecularRenderer) withoutWater() *SpecularRenderer {
+	out := *d
+	out.Water = nil
+	return &out
+}
+
 func (d *SpecularRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
 	d.waterHeight = waterHeight
 }
@@ -30,7 +42,11 @@ func (d *SpecularRenderer) Render(p *ParsedLandRecord) *image.RGBA {
 		for x := range gridSize {
 			// Need to invert y
 			iy := gridSize - y - 1
-			img.SetRGBA(x, iy, d.transformHeight(p.heights[y][x]))
+			c := d.transformHeight(p.heights[y][x])
+			if d.Water != nil && c.A > 0 {
+				c.A = d.Water.specular(p.x, p.y, x, y)
+			}
+			img.SetRGBA(x, iy, c)
 		}
 	}
 	return img
@@ -1,6 +1,7 @@
 package hdmap
 
 import (
+	"cmp"
 	"context"
 	"encoding/json"
 	"fmt"
@@ -38,7 +39,49 @@ func newAnnotatedDirectory(path string) (*annotatedDirectory, error) {
 	}, nil
 }
 
-func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThreads int, vanity bool, rampPath string) error {
+// DrawOptions controls how DrawMaps renders the world.
+type DrawOptions struct {
+	// Threads is the maximum number of textures to render at once.
+	Threads int
+	// Vanity also renders the whole world into a single png.
+	Vanity bool
+	// RampPath is a ramp file, or the name of a built-in ramp.
+	RampPath string
+	// ShelfDistance is how far, in cells, missing cells take to slope
+	// down from the coast to the sea floor.
+	ShelfDistance float64
+	// SeamReport writes mismatched cell edges to seams.json.
+	SeamReport bool
+	// BlendSeams smooths over mismatched cell edges before rendering.
+	BlendSeams bool
+	// Regions renders a transparent region overlay for each submap,
+	// and a region-tinted vanity map if Vanity is also set.
+	Regions bool
+	// Travel renders a transparent travel route overlay for each submap.
+	Travel bool
+	// FootprintRules, if set, renders a transparent overlay of building,
+	// road, wall, and dock footprints for the detail map. It's a rules
+	// file, or "default" for the built-in rules.
+	FootprintRules string
+	// BiomeRules is a rules file, or "default" for the built-in rules,
+	// used to sort land textures into biomes for maps.json.
+	BiomeRules string
+	// Biomes also renders a biome map for each submap.
+	Biomes bool
+	// RoadPattern, if set, finds roads from land textures that match
+	// it and draws them over the classic and detail maps. It's a
+	// regular expression, or "default" for the built-in one.
+	RoadPattern string
+	// Water tints lakes and rivers on the classic and detail maps,
+	// and gives them their own specular strength.
+	Water bool
+	// Tiles writes the classic and detail maps as slippy map tile
+	// pyramids into tiles/classic and tiles/detail.
+	Tiles bool
+}
+
+func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, opts DrawOptions) error {
+	rampPath := opts.RampPath
 	core00DataPath, err := newAnnotatedDirectory(filepath.Join(rootPath, "00 Core", "scripts", "LivelyMap", "data"))
 	if err != nil {
 		return err
@@ -64,6 +107,11 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 		return err
 	}
 
+	coreTexturePath, err := newAnnotatedDirectory(filepath.Join(rootPath, "00 Core", "textures", "LivelyMap"))
+	if err != nil {
+		return err
+	}
+
 	texturePaths := []*annotatedDirectory{
 		classicTexturePath,
 		detailTexturePath,
@@ -72,13 +120,39 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 
 	fmt.Printf("Parsing %d plugins...\n", len(env.Plugins))
 	parsedLands := NewLandParser(env)
+	parsedLands.ShelfDistance = opts.ShelfDistance
+	parsedLands.BlendSeams = opts.BlendSeams
 	if err := parsedLands.ParsePlugins(); err != nil {
 		return fmt.Errorf("parse plugins: %w", err)
 	}
+	if opts.SeamReport {
+		for _, seam := range parsedLands.Seams {
+			fmt.Printf("Seam: %s\n", seam)
+		}
+		if err := writeSeamReport(filepath.Join(rootPath, "seams.json"), parsedLands.Seams); err != nil {
+			return fmt.Errorf("write seam report: %w", err)
+		}
+	}
 	fmt.Printf("Found %d land textures.\n", len(parsedLands.LandTextures))
 
 	fmt.Printf("Done parsing %d cells.\n", len(parsedLands.Lands))
 
+	var roads []*Road
+	if len(opts.RoadPattern) > 0 {
+		pattern, err := RoadPattern(opts.RoadPattern)
+		if err != nil {
+			return err
+		}
+		roads = parsedLands.Roads(pattern)
+		fmt.Printf("Found %d roads.\n", len(roads))
+		if err := RoadsGeoJSON(roads).Write(filepath.Join(rootPath, "roads.geojson")); err != nil {
+			return fmt.Errorf("export roads: %w", err)
+		}
+	}
+
+	water := parsedLands.Water()
+	fmt.Printf("Found %d water bodies.\n", len(water.Bodies))
+
 	// Render individual normal cells
 	fmt.Printf("Rendering %d normalheightmap cells...\n", len(parsedLands.Lands))
 	normalCells := NewCellMapper(parsedLands, &NormalHeightRenderer{})
@@ -91,7 +165,14 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 	if err != nil {
 		return fmt.Errorf("new classic renderer")
 	}
-	classicColorCells := NewCellMapper(parsedLands, renderer)
+	var classicRenderer CellRenderer = renderer
+	if opts.Water {
+		classicRenderer = NewWaterRenderer(water, classicRenderer)
+	}
+	if roads != nil {
+		classicRenderer = NewRoadRenderer(roads, classicRenderer)
+	}
+	classicColorCells := NewCellMapper(parsedLands, classicRenderer)
 	if err := classicColorCells.Generate(ctx); err != nil {
 		return fmt.Errorf("generate cell maps: %w", err)
 	}
@@ -101,6 +182,9 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 	if err != nil {
 		return fmt.Errorf("new specular renderer")
 	}
+	if opts.Water {
+		specRenderer.Water = water
+	}
 	specularCells := NewCellMapper(parsedLands, specRenderer)
 	if err := specularCells.Generate(ctx); err != nil {
 		return fmt.Errorf("generate cell maps: %w", err)
@@ -121,11 +205,78 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 	if err != nil {
 		return fmt.Errorf("new detailed renderer: %w", err)
 	}
-	texturedCells := NewCellMapper(parsedLands, texturedRenderer)
+	var detailRenderer CellRenderer = texturedRenderer
+	if opts.Water {
+		detailRenderer = NewWaterRenderer(water, detailRenderer)
+	}
+	if roads != nil {
+		detailRenderer = NewRoadRenderer(roads, detailRenderer)
+	}
+	texturedCells := NewCellMapper(parsedLands, detailRenderer)
 	if err := texturedCells.Generate(ctx); err != nil {
 		return fmt.Errorf("generate cell maps: %w", err)
 	}
 
+	var regionCells, regionVanityCells *CellMapper
+	if opts.Regions {
+		fmt.Printf("Rendering %d region cells for %d regions...\n", len(parsedLands.Lands), len(parsedLands.Regions))
+		regionCells = NewCellMapper(parsedLands, NewRegionRenderer(parsedLands, nil))
+		if err := regionCells.Generate(ctx); err != nil {
+			return fmt.Errorf("generate cell maps: %w", err)
+		}
+		if opts.Vanity {
+			regionVanityCells = NewCellMapper(parsedLands, NewRegionRenderer(parsedLands, detailRenderer))
+			if err := regionVanityCells.Generate(ctx); err != nil {
+				return fmt.Errorf("generate cell maps: %w", err)
+			}
+		}
+	}
+
+	submaps := Partition(parsedLands.MapExtents)
+	travel := parsedLands.Travel(submaps)
+	fmt.Printf("Found %d travel services with %d routes.\n", len(travel.Nodes), len(travel.Edges))
+	var travelCells *CellMapper
+	if opts.Travel {
+		fmt.Printf("Rendering %d travel route cells...\n", len(parsedLands.Lands))
+		travelCells = NewCellMapper(parsedLands, NewTravelRenderer(travel))
+		if err := travelCells.Generate(ctx); err != nil {
+			return fmt.Errorf("generate cell maps: %w", err)
+		}
+	}
+
+	var footprintCells, footprintVanityCells *CellMapper
+	if len(opts.FootprintRules) > 0 {
+		rules, err := LoadFootprintRules(opts.FootprintRules)
+		if err != nil {
+			return fmt.Errorf("load footprint rules: %w", err)
+		}
+		footprints := parsedLands.Footprints(rules)
+		fmt.Printf("Rendering %d footprint cells...\n", len(parsedLands.Lands))
+		footprintCells = NewCellMapper(parsedLands, NewFootprintRenderer(footprints, nil))
+		if err := footprintCells.Generate(ctx); err != nil {
+			return fmt.Errorf("generate cell maps: %w", err)
+		}
+		if opts.Vanity {
+			footprintVanityCells = NewCellMapper(parsedLands, NewFootprintRenderer(footprints, detailRenderer))
+			if err := footprintVanityCells.Generate(ctx); err != nil {
+				return fmt.Errorf("generate cell maps: %w", err)
+			}
+		}
+	}
+
+	biomeRules, err := LoadBiomeRules(cmp.Or(opts.BiomeRules, "default"))
+	if err != nil {
+		return fmt.Errorf("load biome rules: %w", err)
+	}
+	var biomeCells *CellMapper
+	if opts.Biomes {
+		fmt.Printf("Rendering %d biome cells...\n", len(parsedLands.Lands))
+		biomeCells = NewCellMapper(parsedLands, NewBiomeRenderer(biomeRules, parsedLands.TextureNames))
+		if err := biomeCells.Generate(ctx); err != nil {
+			return fmt.Errorf("generate cell maps: %w", err)
+		}
+	}
+
 	fmt.Printf("Setting up world map joiners...\n")
 
 	// Set up jobs to join the sub-images together.
@@ -133,7 +284,7 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 	mapInfos := map[string]SubmapNode{}
 	mapJobs := []*mapRenderJob{}
 	allHeights := map[string]float32{}
-	for _, extents := range Partition(parsedLands.MapExtents) {
+	for _, extents := range submaps {
 		mapInfos[strconv.Itoa(int(extents.ID))] = extents
 		if classicTexturePath.available {
 			mapJobs = append(mapJobs, &mapRenderJob{
@@ -242,10 +393,59 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 				Codec: dds.DXT5,
 			})
 		}
+
+		if regionCells != nil && coreTexturePath.available {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: coreTexturePath.path,
+				Name:      fmt.Sprintf("world_%d_regions.dds", extents.ID),
+				Extents:   extents.Extents,
+				Cells:     regionCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.PowerOfTwoProcessor{DownScaleFactor: 1},
+				},
+				Codec: dds.DXT5,
+			})
+		}
+		if footprintCells != nil && detailTexturePath.available {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: detailTexturePath.path,
+				Name:      fmt.Sprintf("world_%d_footprints.dds", extents.ID),
+				Extents:   extents.Extents,
+				Cells:     footprintCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.PowerOfTwoProcessor{DownScaleFactor: 1},
+				},
+				Codec: dds.DXT5,
+			})
+		}
+		if biomeCells != nil && coreTexturePath.available {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: coreTexturePath.path,
+				Name:      fmt.Sprintf("world_%d_biomes.dds", extents.ID),
+				Extents:   extents.Extents,
+				Cells:     biomeCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.PowerOfTwoProcessor{DownScaleFactor: 1},
+				},
+				Codec: dds.DXT1,
+			})
+		}
+		if travelCells != nil && coreTexturePath.available {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: coreTexturePath.path,
+				Name:      fmt.Sprintf("world_%d_travel.dds", extents.ID),
+				Extents:   extents.Extents,
+				Cells:     travelCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.PowerOfTwoProcessor{DownScaleFactor: 1},
+				},
+				Codec: dds.DXT5,
+			})
+		}
 	}
 
 	// vanity map
-	if vanity {
+	if opts.Vanity {
 		mapJobs = append(mapJobs, &mapRenderJob{
 			Directory: rootPath,
 			Name:      "vanity.png",
@@ -255,10 +455,40 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 				&postprocessors.SMAA{},
 			},
 		})
+		if regionVanityCells != nil {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: rootPath,
+				Name:      "vanity_regions.png",
+				Extents:   parsedLands.MapExtents,
+				Cells:     regionVanityCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.SMAA{},
+				},
+			})
+		}
+		if biomeCells != nil {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: rootPath,
+				Name:      "vanity_biomes.png",
+				Extents:   parsedLands.MapExtents,
+				Cells:     biomeCells,
+			})
+		}
+		if footprintVanityCells != nil {
+			mapJobs = append(mapJobs, &mapRenderJob{
+				Directory: rootPath,
+				Name:      "vanity_footprints.png",
+				Extents:   parsedLands.MapExtents,
+				Cells:     footprintVanityCells,
+				PostProcessors: []PostProcessor{
+					&postprocessors.SMAA{},
+				},
+			})
+		}
 	}
 
 	g, gctx := errgroup.WithContext(ctx)
-	g.SetLimit(maxThreads)
+	g.SetLimit(opts.Threads)
 	for _, m := range mapJobs {
 		g.Go(func() error { return m.Draw(gctx) })
 	}
@@ -267,12 +497,36 @@ func DrawMaps(ctx context.Context, rootPath string, env *cfg.Environment, maxThr
 		return fmt.Errorf("generate textures: %w", err)
 	}
 
+	if opts.Tiles {
+		for name, cells := range map[string]*CellMapper{"classic": classicColorCells, "detail": texturedCells} {
+			if _, err := WriteTiles(ctx, filepath.Join(rootPath, "tiles", name), parsedLands.MapExtents, cells.Cells, opts.Threads); err != nil {
+				return fmt.Errorf("write %s tiles: %w", name, err)
+			}
+		}
+	}
+
+	places := parsedLands.Places(submaps)
+	fmt.Printf("Found %d named places.\n", len(places))
+	if err := writePlaces(filepath.Join(core00DataPath.path, "places.json"), places); err != nil {
+		return fmt.Errorf("write places: %w", err)
+	}
+	entrances := parsedLands.Entrances(submaps)
+	fmt.Printf("Found %d interior entrances.\n", len(entrances))
+	if err := writeEntrances(filepath.Join(core00DataPath.path, "entrances.json"), entrances); err != nil {
+		return fmt.Errorf("write entrances: %w", err)
+	}
+	if err := writeTravel(filepath.Join(core00DataPath.path, "travel.json"), travel); err != nil {
+		return fmt.Errorf("write travel: %w", err)
+	}
+
 	// Save map image info so the Lua mod knows what to do with them:
 	return printMapInfo(
 		filepath.Join(core00DataPath.path, "maps.json"),
 		parsedLands,
 		mapInfos,
 		allHeights,
+		parsedLands.BiomeHistograms(biomeRules),
+		water.Bodies,
 	)
 }
 
@@ -289,7 +543,9 @@ func renderSky(textureFolder string, colorRenderer CellRenderer, specularRendere
 		}
 	}
 	{
-		skyImgSpec := specularRenderer.Render(NewFallbackLandRecord())
+		// The fallback record is at cell 0,0, so it'd pick up that
+		// cell's water.
+		skyImgSpec := specularRenderer.withoutWater().Render(NewFallbackLandRecord())
 		fullPath := path.Join(textureFolder, "sky_spec.dds")
 		out, err := os.Create(fullPath)
 		if err != nil {
@@ -302,15 +558,28 @@ func renderSky(textureFolder string, colorRenderer CellRenderer, specularRendere
 	return nil
 }
 
-func printMapInfo(path string, parsedLands *LandParser, maps map[string]SubmapNode, allHeights map[string]float32) error {
+func printMapInfo(path string, parsedLands *LandParser, maps map[string]SubmapNode, allHeights map[string]float32, biomes map[string]map[string]int, water []*WaterBody) error {
 	container := struct {
 		Maps      map[string]SubmapNode
 		MaxHeight float64
 		Heights   map[string]float32
+		// Regions is keyed by lowercase region ID.
+		Regions map[string]*RegionInfo
+		// CellRegions maps "x,y" cell coordinates to region IDs.
+		CellRegions map[string]string
+		// Biomes maps "x,y" cell coordinates to the number of
+		// texture patches of each biome in the cell.
+		Biomes map[string]map[string]int
+		// Water lists the ocean, lakes, and rivers.
+		Water []*WaterBody
 	}{
-		Maps:      maps,
-		MaxHeight: parsedLands.MaxHeight,
-		Heights:   allHeights,
+		Maps:        maps,
+		MaxHeight:   parsedLands.MaxHeight,
+		Heights:     allHeights,
+		Regions:     parsedLands.RegionTable(),
+		CellRegions: parsedLands.CellRegions(),
+		Biomes:      biomes,
+		Water:       water,
 	}
 	raw, err := json.Marshal(container)
 	if err != nil {
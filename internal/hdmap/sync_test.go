@@ -23,6 +23,10 @@ func BenchmarkGeneration(b *testing.B) {
 	b.Logf("root: %q", rootPath)
 
 	for b.Loop() {
-		require.NoError(b, DrawMaps(b.Context(), rootPath, env, 6, true, ""))
+		require.NoError(b, DrawMaps(b.Context(), rootPath, env, DrawOptions{
+			Threads:       6,
+			Vanity:        true,
+			ShelfDistance: 1,
+		}))
 	}
 }
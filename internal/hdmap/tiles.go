@@ -0,0 +1,242 @@
+package hdmap
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+
+	"golang.org/x/sync/errgroup"
+)
+
+const (
+	// tileSize is the width and height of a map tile, in pixels.
+	tileSize = 256
+	// tileCells is the number of cells along the edge of a tile at
+	// the most detailed zoom level.
+	tileCells = tileSize / gridSize
+)
+
+// TileMetadata describes a tile pyramid so a Leaflet map can show it.
+//
+// Tiles are at {z}/{x}/{y}.png, with x growing to the east and y
+// growing to the south from the top left corner of the map. Zoom
+// level MaxZoom has one pixel per LAND vertex, and each zoom level
+// below it halves the resolution.
+//
+// Leaflet can use world units as map coordinates with a CRS that
+// extends L.CRS.Simple with
+// `transformation: new L.Transformation(...Transformation)`.
+// Leaflet's LatLng is then [y, x].
+type TileMetadata struct {
+	TileSize int
+	MinZoom  int
+	MaxZoom  int
+	Format   string
+	URL      string
+	// Bounds is the left, bottom, right, and top of the map,
+	// in world units.
+	Bounds [4]float64
+	// Transformation turns world units into pixels at zoom level 0,
+	// as Leaflet's a, b, c, d: px = a*x + b, py = c*y + d.
+	Transformation [4]float64
+	// UnitsPerPixel is the number of world units in a pixel at
+	// MaxZoom.
+	UnitsPerPixel float64
+}
+
+// tileKey is a tile's x, y position in its zoom level.
+type tileKey [2]int
+
+// WriteTiles renders cells into a z/x/y PNG tile pyramid in dir, and
+// writes tiles.json to describe it. WebP would be smaller, but there's
+// no pure Go WebP encoder.
+//
+// Tiles are built one at a time, so the whole map is never in memory
+// at once. Lower zoom levels are built from the tiles already written
+// for the level above them. Tiles with no cells are skipped.
+func WriteTiles(ctx context.Context, dir string, extents MapCoords, cells []*CellInfo, threads int) (*TileMetadata, error) {
+	side := max(extents.Width(), extents.Height())
+	// The fewest tiles along an edge that cover the whole map.
+	maxZoom := bits.Len32(uint32(side-1) / tileCells)
+	byCell := map[uint64]*CellInfo{}
+	for _, cell := range cells {
+		byCell[coordKey(cell.X, cell.Y)] = cell
+	}
+
+	tilePath := func(z int, key tileKey) string {
+		return filepath.Join(dir, strconv.Itoa(z), strconv.Itoa(key[0]), strconv.Itoa(key[1])+".png")
+	}
+	var mux sync.Mutex
+	written := map[tileKey]bool{}
+	build := func(z int, keys []tileKey, draw func(key tileKey) (*image.RGBA, error)) error {
+		g, gctx := errgroup.WithContext(ctx)
+		g.SetLimit(max(threads, 1))
+		for _, key := range keys {
+			g.Go(func() error {
+				if err := gctx.Err(); err != nil {
+					return err
+				}
+				img, err := draw(key)
+				if err != nil || img == nil {
+					return err
+				}
+				if err := writePNG(tilePath(z, key), img); err != nil {
+					return err
+				}
+				mux.Lock()
+				defer mux.Unlock()
+				written[key] = true
+				return nil
+			})
+		}
+		return g.Wait()
+	}
+
+	// The most detailed level is drawn from cells.
+	n := 1 << maxZoom
+	keys := []tileKey{}
+	for tx := range n {
+		for ty := range n {
+			keys = append(keys, tileKey{tx, ty})
+		}
+	}
+	fmt.Printf("Writing zoom level %d tiles to %q...\n", maxZoom, dir)
+	if err := build(maxZoom, keys, func(key tileKey) (*image.RGBA, error) {
+		var img *image.RGBA
+		for i := range tileCells {
+			for j := range tileCells {
+				cell, ok := byCell[coordKey(extents.Left+int32(key[0]*tileCells+i), extents.Top-int32(key[1]*tileCells+j))]
+				if !ok {
+					continue
+				}
+				if img == nil {
+					img = image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+				}
+				for y := range gridSize {
+					copy(img.Pix[img.PixOffset(i*gridSize, j*gridSize+y):], cell.Image.Pix[cell.Image.PixOffset(0, y):cell.Image.PixOffset(gridSize, y)])
+				}
+			}
+		}
+		return img, nil
+	}); err != nil {
+		return nil, fmt.Errorf("write zoom level %d: %w", maxZoom, err)
+	}
+
+	// Each tile in the levels below is its four children, shrunk.
+	for z := maxZoom - 1; z >= 0; z-- {
+		children := written
+		written = map[tileKey]bool{}
+		parents := map[tileKey]bool{}
+		for child := range children {
+			parents[tileKey{child[0] / 2, child[1] / 2}] = true
+		}
+		keys := make([]tileKey, 0, len(parents))
+		for key := range parents {
+			keys = append(keys, key)
+		}
+		fmt.Printf("Writing %d zoom level %d tiles...\n", len(keys), z)
+		if err := build(z, keys, func(key tileKey) (*image.RGBA, error) {
+			img := image.NewRGBA(image.Rect(0, 0, tileSize, tileSize))
+			for i := range 2 {
+				for j := range 2 {
+					child := tileKey{key[0]*2 + i, key[1]*2 + j}
+					if !children[child] {
+						continue
+					}
+					src, err := readPNG(tilePath(z+1, child))
+					if err != nil {
+						return nil, err
+					}
+					halve(img, src, i*tileSize/2, j*tileSize/2)
+				}
+			}
+			return img, nil
+		}); err != nil {
+			return nil, fmt.Errorf("write zoom level %d: %w", z, err)
+		}
+	}
+
+	unitsPerPixel := float64(cellUnits) / gridSize
+	scale := 1 / (unitsPerPixel * float64(n))
+	left, top := float64(extents.Left)*cellUnits, float64(extents.Top+1)*cellUnits
+	meta := &TileMetadata{
+		TileSize: tileSize,
+		MinZoom:  0,
+		MaxZoom:  maxZoom,
+		Format:   "png",
+		URL:      "{z}/{x}/{y}.png",
+		Bounds: [4]float64{
+			left,
+			float64(extents.Bottom) * cellUnits,
+			float64(extents.Right+1) * cellUnits,
+			top,
+		},
+		Transformation: [4]float64{scale, -left * scale, -scale, top * scale},
+		UnitsPerPixel:  unitsPerPixel,
+	}
+	raw, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, fmt.Errorf("marshal tile metadata: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "tiles.json"), raw, 0666); err != nil {
+		return nil, fmt.Errorf("write tile metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// halve shrinks src to half size with a box filter, and draws it into
+// dst with its top left corner at x, y.
+func halve(dst *image.RGBA, src image.Image, x, y int) {
+	b := src.Bounds()
+	for sy := b.Min.Y; sy+1 < b.Max.Y; sy += 2 {
+		for sx := b.Min.X; sx+1 < b.Max.X; sx += 2 {
+			var r, g, bl, a uint32
+			for _, p := range [4][2]int{{0, 0}, {1, 0}, {0, 1}, {1, 1}} {
+				pr, pg, pb, pa := src.At(sx+p[0], sy+p[1]).RGBA()
+				r, g, bl, a = r+pr, g+pg, bl+pb, a+pa
+			}
+			dst.Set(x+(sx-b.Min.X)/2, y+(sy-b.Min.Y)/2, color.RGBA64{
+				R: uint16(r / 4),
+				G: uint16(g / 4),
+				B: uint16(bl / 4),
+				A: uint16(a / 4),
+			})
+		}
+	}
+}
+
+func writePNG(path string, img image.Image) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0777); err != nil {
+		return fmt.Errorf("create %q: %w", filepath.Dir(path), err)
+	}
+	out, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", path, err)
+	}
+	defer out.Close()
+	if err := png.Encode(out, img); err != nil {
+		return fmt.Errorf("encode %q: %w", path, err)
+	}
+	return nil
+}
+
+func readPNG(path string) (image.Image, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open %q: %w", path, err)
+	}
+	defer in.Close()
+	img, err := png.Decode(in)
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	return img, nil
+}
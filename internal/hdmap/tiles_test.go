@@ -0,0 +1,70 @@
+package hdmap
+
+import (
+	"image"
+	"image/color"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTiles(t *testing.T) {
+	extents := MapCoords{Left: -1, Bottom: -1, Right: 4, Top: 4}
+	cellColor := func(x, y int32) color.RGBA {
+		return color.RGBA{R: uint8(x + 10), G: uint8(y + 10), B: 0x80, A: 0xff}
+	}
+	cells := []*CellInfo{}
+	for x := extents.Left; x <= extents.Right; x++ {
+		for y := extents.Bottom; y <= extents.Top; y++ {
+			img := image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+			for i := range gridSize * gridSize {
+				img.SetRGBA(i%gridSize, i/gridSize, cellColor(x, y))
+			}
+			cells = append(cells, &CellInfo{X: x, Y: y, Image: img})
+		}
+	}
+
+	dir := t.TempDir()
+	meta, err := WriteTiles(t.Context(), dir, extents, cells, 2)
+	require.NoError(t, err)
+	// 6 cells wide needs 2 tiles, which is zoom level 1.
+	require.Equal(t, 1, meta.MaxZoom)
+	require.Equal(t, [4]float64{-cellUnits, -cellUnits, 5 * cellUnits, 5 * cellUnits}, meta.Bounds)
+	require.FileExists(t, filepath.Join(dir, "tiles.json"))
+
+	// The top left of the map is the top left of every tile 0,0.
+	topLeft, err := readPNG(filepath.Join(dir, "1", "0", "0.png"))
+	require.NoError(t, err)
+	require.Equal(t, cellColor(-1, 4), color.RGBAModel.Convert(topLeft.At(0, 0)))
+	require.Equal(t, cellColor(0, 4), color.RGBAModel.Convert(topLeft.At(gridSize, 0)))
+	require.Equal(t, cellColor(-1, 3), color.RGBAModel.Convert(topLeft.At(0, gridSize)))
+	root, err := readPNG(filepath.Join(dir, "0", "0", "0.png"))
+	require.NoError(t, err)
+	require.Equal(t, cellColor(-1, 4), color.RGBAModel.Convert(root.At(0, 0)))
+
+	// The bottom right tile is mostly past the edge of the map.
+	bottomRight, err := readPNG(filepath.Join(dir, "1", "1", "1.png"))
+	require.NoError(t, err)
+	require.Equal(t, cellColor(4, -1), color.RGBAModel.Convert(bottomRight.At(gridSize, gridSize)))
+	_, _, _, a := bottomRight.At(tileSize-1, tileSize-1).RGBA()
+	require.Zero(t, a)
+
+	// Leaflet puts the top left corner of the map at pixel 0,0,
+	// and cell edges on texture pixel edges at the most detailed zoom.
+	project := func(x, y float64) (float64, float64) {
+		scale := float64(int(1) << meta.MaxZoom)
+		tr := meta.Transformation
+		return scale * (tr[0]*x + tr[1]), scale * (tr[2]*y + tr[3])
+	}
+	px, py := project(-cellUnits, 5*cellUnits)
+	require.InDelta(t, 0, px, 1e-9)
+	require.InDelta(t, 0, py, 1e-9)
+	px, py = project(0, 4*cellUnits)
+	require.InDelta(t, gridSize, px, 1e-9)
+	require.InDelta(t, gridSize, py, 1e-9)
+
+	_, err = os.Stat(filepath.Join(dir, "2"))
+	require.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,285 @@
+package hdmap
+
+import (
+	"cmp"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/color"
+	"math"
+	"os"
+	"slices"
+	"strings"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+)
+
+const npcCNAM esm.SubrecordTag = "CNAM"
+
+// travelSnapDistance is how close, in world units, a travel destination
+// has to be to a service provider to count as arriving at it.
+const travelSnapDistance = cellUnits / 2
+
+// travelServices maps NPC classes to the kind of travel they offer.
+var travelServices = map[string]string{
+	"caravaner":   "silt strider",
+	"shipmaster":  "boat",
+	"gondolier":   "gondola",
+	"guild guide": "guild guide",
+}
+
+// travelColors are the route colors for each kind of travel.
+var travelColors = map[string]color.RGBA{
+	"silt strider": {R: 0xc0, G: 0x80, B: 0x30, A: 0xff},
+	"boat":         {R: 0x30, G: 0x60, B: 0xd0, A: 0xff},
+	"gondola":      {R: 0x30, G: 0xb0, B: 0xb0, A: 0xff},
+	"guild guide":  {R: 0xa0, G: 0x40, B: 0xc0, A: 0xff},
+}
+
+var defaultTravelColor = color.RGBA{R: 0xe0, G: 0xe0, B: 0xe0, A: 0xff}
+
+// TravelNode is an NPC that offers travel, and where they are.
+type TravelNode struct {
+	ID      string
+	Name    string
+	Service string
+	// X and Y are the world position of the NPC, or of the
+	// entrance to the interior they're in.
+	X float32
+	Y float32
+	// Cell is the interior the NPC is in, if they are inside.
+	Cell    string `json:",omitempty"`
+	Submaps []SubmapID
+}
+
+// TravelEdge is a destination offered by a TravelNode.
+type TravelEdge struct {
+	From    string
+	Service string
+	// To is the provider found at the destination, if there is one.
+	To string `json:",omitempty"`
+	// X and Y are the world position of the destination, or of the
+	// entrance to the interior it's in.
+	X float32
+	Y float32
+	// Cell is the destination interior, if it's inside.
+	Cell string `json:",omitempty"`
+}
+
+// TravelNetwork is the graph of every travel service.
+type TravelNetwork struct {
+	Nodes []*TravelNode
+	Edges []*TravelEdge
+}
+
+// travelProvider is an NPC record with travel destinations.
+type travelProvider struct {
+	obj     *object
+	class   string
+	service string
+	dests   []*destination
+}
+
+func parseTravelProvider(obj *object) (*travelProvider, error) {
+	out := &travelProvider{obj: obj}
+	for _, sub := range obj.rec.Subrecords {
+		switch sub.Tag {
+		case npcCNAM:
+			out.class = strings.ToLower(zstring(sub.Data))
+		case cell.DODT:
+			if len(sub.Data) < 24 {
+				return nil, fmt.Errorf("NPC_.DODT too short: %d < 24", len(sub.Data))
+			}
+			dest := cell.DODTField{}
+			if err := dest.Unmarshal(sub); err != nil {
+				return nil, fmt.Errorf("parse NPC_.DODT: %w", err)
+			}
+			out.dests = append(out.dests, &destination{X: dest.PosX, Y: dest.PosY, Z: dest.PosZ})
+		case refDNAM:
+			if len(out.dests) > 0 {
+				out.dests[len(out.dests)-1].Cell = zstring(sub.Data)
+			}
+		}
+	}
+	out.service = cmp.Or(travelServices[out.class], out.class, "travel")
+	return out, nil
+}
+
+// interiorLocations works out where each interior cell is on the
+// exterior map. Interiors are placed at the door that leads into them,
+// or at the door that leads out of them, or at the location of a
+// neighboring interior.
+func (l *LandParser) interiorLocations() map[string][2]float32 {
+	out := map[string][2]float32{}
+	refs := l.liveRefs()
+	for _, ref := range refs {
+		if ref.cell.interior || ref.dest == nil || len(ref.dest.Cell) == 0 {
+			continue
+		}
+		key := strings.ToLower(ref.dest.Cell)
+		if _, ok := out[key]; !ok {
+			out[key] = [2]float32{ref.x, ref.y}
+		}
+	}
+	interiorDoors := slices.DeleteFunc(slices.Clone(refs), func(ref *cellRef) bool {
+		return !ref.cell.interior || ref.dest == nil
+	})
+	for _, ref := range interiorDoors {
+		key := strings.ToLower(ref.cell.name)
+		if _, ok := out[key]; !ok && len(ref.dest.Cell) == 0 {
+			out[key] = [2]float32{ref.dest.X, ref.dest.Y}
+		}
+	}
+	// Spread out to interiors that only connect to other interiors.
+	for changed := true; changed; {
+		changed = false
+		for _, ref := range interiorDoors {
+			from := strings.ToLower(ref.cell.name)
+			to := strings.ToLower(ref.dest.Cell)
+			if len(to) == 0 {
+				continue
+			}
+			fromPos, fromOK := out[from]
+			toPos, toOK := out[to]
+			if fromOK && !toOK {
+				out[to] = fromPos
+				changed = true
+			} else if toOK && !fromOK {
+				out[from] = toPos
+				changed = true
+			}
+		}
+	}
+	return out
+}
+
+// Travel builds the network of travel services. Only NPCs with travel
+// destinations count. Travel that scripts or spells do, like Propylon
+// indices, Mark and Recall, and Intervention, isn't included.
+func (l *LandParser) Travel(submaps []SubmapNode) *TravelNetwork {
+	out := &TravelNetwork{Nodes: []*TravelNode{}, Edges: []*TravelEdge{}}
+
+	providers := map[string]*travelProvider{}
+	for id, obj := range l.objects {
+		if obj.tag != NPC_ {
+			continue
+		}
+		provider, err := parseTravelProvider(obj)
+		if err != nil {
+			fmt.Printf("skipping travel for %q: %v\n", id, err)
+			continue
+		}
+		if len(provider.dests) > 0 {
+			providers[id] = provider
+		}
+	}
+
+	interiors := l.interiorLocations()
+	locate := func(x, y float32, interior string) (float32, float32, bool) {
+		if len(interior) == 0 {
+			return x, y, true
+		}
+		pos, ok := interiors[strings.ToLower(interior)]
+		return pos[0], pos[1], ok
+	}
+
+	nodeProviders := map[*TravelNode]*travelProvider{}
+	for _, ref := range l.liveRefs() {
+		provider, ok := providers[ref.object]
+		if !ok {
+			continue
+		}
+		node := &TravelNode{
+			ID:      ref.object,
+			Name:    provider.obj.name,
+			Service: provider.service,
+		}
+		interior := ""
+		if ref.cell.interior {
+			interior = ref.cell.name
+			node.Cell = interior
+		}
+		x, y, ok := locate(ref.x, ref.y, interior)
+		if !ok {
+			fmt.Printf("can't find %q on the map; skipping its travel\n", interior)
+			continue
+		}
+		node.X, node.Y = x, y
+		node.Submaps = submapsContaining(submaps, worldToCell(x), worldToCell(y))
+		out.Nodes = append(out.Nodes, node)
+		nodeProviders[node] = provider
+	}
+
+	// NPCs placed more than once get numbered IDs.
+	seen := map[string]int{}
+	for _, node := range out.Nodes {
+		seen[node.ID]++
+		if n := seen[node.ID]; n > 1 {
+			node.ID = fmt.Sprintf("%s#%d", node.ID, n)
+		}
+	}
+
+	for _, node := range out.Nodes {
+		for _, dest := range nodeProviders[node].dests {
+			x, y, ok := locate(dest.X, dest.Y, dest.Cell)
+			if !ok {
+				fmt.Printf("can't find %q on the map; skipping route from %q\n", dest.Cell, node.ID)
+				continue
+			}
+			edge := &TravelEdge{From: node.ID, Service: node.Service, X: x, Y: y, Cell: dest.Cell}
+			best := math.Inf(1)
+			for _, other := range out.Nodes {
+				if other == node || other.Service != node.Service {
+					continue
+				}
+				if d := math.Hypot(float64(other.X-x), float64(other.Y-y)); d < travelSnapDistance && d < best {
+					best = d
+					edge.To = other.ID
+				}
+			}
+			out.Edges = append(out.Edges, edge)
+		}
+	}
+	return out
+}
+
+func writeTravel(path string, network *TravelNetwork) error {
+	raw, err := json.Marshal(network)
+	if err != nil {
+		return fmt.Errorf("marshal travel json: %w", err)
+	}
+	return os.WriteFile(path, raw, 0666)
+}
+
+// TravelRenderer draws travel routes as lines over a transparent
+// background, colored by the kind of travel.
+type TravelRenderer struct {
+	network *TravelNetwork
+	from    map[string]*TravelNode
+}
+
+func NewTravelRenderer(network *TravelNetwork) *TravelRenderer {
+	from := map[string]*TravelNode{}
+	for _, node := range network.Nodes {
+		from[node.ID] = node
+	}
+	return &TravelRenderer{network: network, from: from}
+}
+
+func (d *TravelRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {}
+
+func (d *TravelRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, gridSize, gridSize))
+	for _, edge := range d.network.Edges {
+		node := d.from[edge.From]
+		x0, y0 := cellPixel(p.x, p.y, node.X, node.Y)
+		x1, y1 := cellPixel(p.x, p.y, edge.X, edge.Y)
+		drawSegment(img, x0, y0, x1, y1, 2, cmp.Or(travelColors[edge.Service], defaultTravelColor))
+	}
+	for _, node := range d.network.Nodes {
+		x, y := cellPixel(p.x, p.y, node.X, node.Y)
+		drawDot(img, x, y, 3, cmp.Or(travelColors[node.Service], defaultTravelColor))
+	}
+	return img
+}
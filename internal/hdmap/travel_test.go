@@ -0,0 +1,85 @@
+package hdmap
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/cell"
+	"github.com/stretchr/testify/require"
+)
+
+// npcRecord makes an NPC that offers travel to dests.
+func npcRecord(id, class string, dests ...destination) *esm.Record {
+	rec := &esm.Record{
+		Tag: NPC_,
+		Subrecords: []*esm.Subrecord{
+			{Tag: objNAME, Data: zdata(id)},
+			{Tag: objFNAM, Data: zdata(id)},
+			{Tag: npcCNAM, Data: zdata(class)},
+		},
+	}
+	for _, dest := range dests {
+		dodt := make([]byte, 24)
+		binary.LittleEndian.PutUint32(dodt[0:4], math.Float32bits(dest.X))
+		binary.LittleEndian.PutUint32(dodt[4:8], math.Float32bits(dest.Y))
+		rec.Subrecords = append(rec.Subrecords, &esm.Subrecord{Tag: cell.DODT, Data: dodt})
+		if len(dest.Cell) > 0 {
+			rec.Subrecords = append(rec.Subrecords, &esm.Subrecord{Tag: refDNAM, Data: zdata(dest.Cell)})
+		}
+	}
+	return rec
+}
+
+func TestTravel(t *testing.T) {
+	dir := t.TempDir()
+	master := writePlugin(t, dir, "Master.esm",
+		npcRecord("seyda_caravaner", "Caravaner", destination{X: 3 * cellUnits, Y: 100}),
+		npcRecord("balmora_caravaner", "Caravaner", destination{X: 100, Y: 100}),
+		npcRecord("balmora_guide", "Guild Guide", destination{Cell: "Vivec, Guild of Mages"}),
+		cellRecord("", 0, 0, "", slices.Concat(
+			refSubrecords(1, "seyda_caravaner", 100, 100),
+			doorSubrecords(2, "ex_door", 500, 100, "Balmora, Guild of Mages", 0),
+		)...),
+		cellRecord("", 3, 0, "", refSubrecords(3, "balmora_caravaner", 3*cellUnits+100, 100)...),
+		interiorCellRecord("Balmora, Guild of Mages", slices.Concat(
+			refSubrecords(4, "balmora_guide", 0, 0),
+			// the basement is only reachable from inside
+			doorSubrecords(5, "in_door", 0, 0, "Balmora, Guild of Mages, Basement", 0),
+		)...),
+		landRecord(0, 0, 1),
+	)
+
+	lp := NewLandParser(&cfg.Environment{Plugins: []string{master}})
+	require.NoError(t, lp.ParsePlugins())
+
+	locations := lp.interiorLocations()
+	require.Equal(t, [2]float32{500, 100}, locations["balmora, guild of mages"])
+	require.Equal(t, [2]float32{500, 100}, locations["balmora, guild of mages, basement"])
+
+	network := lp.Travel(nil)
+	require.Len(t, network.Nodes, 3)
+	guide := network.Nodes[slices.IndexFunc(network.Nodes, func(n *TravelNode) bool { return n.ID == "balmora_guide" })]
+	require.Equal(t, "guild guide", guide.Service)
+	require.Equal(t, "Balmora, Guild of Mages", guide.Cell)
+	require.Equal(t, float32(500), guide.X)
+
+	// the guide's destination isn't on the map
+	require.Len(t, network.Edges, 2)
+	for _, edge := range network.Edges {
+		require.Equal(t, "silt strider", edge.Service)
+		if edge.From == "seyda_caravaner" {
+			require.Equal(t, "balmora_caravaner", edge.To)
+		} else {
+			require.Equal(t, "seyda_caravaner", edge.To)
+		}
+	}
+
+	// the route between the caravaners crosses cell 1,0
+	img := NewTravelRenderer(network).Render(flatLand(1, 0, 0))
+	require.Equal(t, travelColors["silt strider"], img.RGBAAt(gridSize/2, gridSize-1))
+	require.Equal(t, uint8(0), img.RGBAAt(gridSize/2, gridSize/2).A)
+}
@@ -0,0 +1,219 @@
+package hdmap
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/erinpentecost/LivelyMap/internal/geojson"
+	"github.com/ernmw/omwpacker/cfg"
+)
+
+// VectorOptions controls ExportVectors.
+type VectorOptions struct {
+	// SamplesPerCell is the number of height samples taken along each
+	// cell edge. It must divide 64.
+	SamplesPerCell int
+	// ContourInterval, if positive, also traces contour lines this
+	// many world units apart.
+	ContourInterval float64
+	// Tolerance is how far, in world units, simplified lines can
+	// stray from the traced ones.
+	Tolerance float64
+	// GeoJSONPath, if set, is where to write the GeoJSON.
+	GeoJSONPath string
+	// SVGPath, if set, is where to write the SVG.
+	SVGPath string
+}
+
+// VectorLine is a polyline in world units.
+type VectorLine struct {
+	Points [][2]float64
+	// Area is set if the line is the outline of a shape.
+	Area       bool
+	Properties map[string]any
+}
+
+// VectorLayer is a named set of lines that are drawn the same way.
+type VectorLayer struct {
+	Name  string
+	Lines []*VectorLine
+}
+
+// vectorStyles are the SVG strokes of each layer.
+var vectorStyles = map[string]string{
+	"submaps":   `stroke="#c03030" stroke-width="1.5" stroke-dasharray="6 4"`,
+	"cells":     `stroke="#c8c8c8" stroke-width="0.5"`,
+	"contours":  `stroke="#8a7a5a" stroke-width="0.75"`,
+	"coastline": `stroke="#1b3a5c" stroke-width="2"`,
+}
+
+// Vectors traces coastlines, and contours if opts.ContourInterval is
+// set, and outlines the cell grid and submaps. Layers are ordered
+// bottom to top.
+func (l *LandParser) Vectors(opts VectorOptions) []*VectorLayer {
+	g := newHeightGrid(l, opts.SamplesPerCell)
+	traced := func(level float32) []*VectorLine {
+		out := []*VectorLine{}
+		for _, line := range g.contour(level) {
+			closed := line[0] == line[len(line)-1]
+			line = simplifyLine(line, opts.Tolerance)
+			// Tiny loops simplify down to nothing.
+			if closed && len(line) < 4 {
+				continue
+			}
+			out = append(out, &VectorLine{
+				Points:     line,
+				Properties: map[string]any{"height": level, "closed": closed},
+			})
+		}
+		return out
+	}
+
+	submaps := &VectorLayer{Name: "submaps", Lines: []*VectorLine{}}
+	for _, node := range Partition(l.MapExtents) {
+		submaps.Lines = append(submaps.Lines, &VectorLine{
+			Points: cellsOutline(node.Extents),
+			Area:   true,
+			Properties: map[string]any{
+				"id":     node.ID,
+				"extent": node.Extents.String(),
+			},
+		})
+	}
+
+	cells := &VectorLayer{Name: "cells", Lines: []*VectorLine{}}
+	e := l.MapExtents
+	for x := e.Left; x <= e.Right+1; x++ {
+		cells.Lines = append(cells.Lines, &VectorLine{
+			Points: [][2]float64{
+				{float64(x) * cellUnits, float64(e.Bottom) * cellUnits},
+				{float64(x) * cellUnits, float64(e.Top+1) * cellUnits},
+			},
+			Properties: map[string]any{"x": x},
+		})
+	}
+	for y := e.Bottom; y <= e.Top+1; y++ {
+		cells.Lines = append(cells.Lines, &VectorLine{
+			Points: [][2]float64{
+				{float64(e.Left) * cellUnits, float64(y) * cellUnits},
+				{float64(e.Right+1) * cellUnits, float64(y) * cellUnits},
+			},
+			Properties: map[string]any{"y": y},
+		})
+	}
+
+	contours := &VectorLayer{Name: "contours", Lines: []*VectorLine{}}
+	if opts.ContourInterval > 0 {
+		lowest, highest := float32(math.Inf(1)), float32(math.Inf(-1))
+		for _, h := range g.heights {
+			lowest, highest = min(lowest, h), max(highest, h)
+		}
+		first := math.Ceil(float64(lowest)/opts.ContourInterval) * opts.ContourInterval
+		for level := first; level <= float64(highest); level += opts.ContourInterval {
+			// The coastline has its own layer.
+			if level != 0 {
+				contours.Lines = append(contours.Lines, traced(float32(level))...)
+			}
+		}
+	}
+
+	coastline := &VectorLayer{Name: "coastline", Lines: traced(0)}
+	return []*VectorLayer{submaps, cells, contours, coastline}
+}
+
+// cellsOutline is the closed outline of some cells, in world units.
+func cellsOutline(m MapCoords) [][2]float64 {
+	left, right := float64(m.Left)*cellUnits, float64(m.Right+1)*cellUnits
+	bottom, top := float64(m.Bottom)*cellUnits, float64(m.Top+1)*cellUnits
+	return [][2]float64{{left, bottom}, {right, bottom}, {right, top}, {left, top}, {left, bottom}}
+}
+
+// VectorsGeoJSON turns vector layers into a GeoJSON feature collection.
+// Each feature's "layer" property is the name of its layer.
+func VectorsGeoJSON(layers []*VectorLayer) *geojson.FeatureCollection {
+	out := geojson.NewFeatureCollection()
+	for _, layer := range layers {
+		for _, line := range layer.Lines {
+			properties := map[string]any{"layer": layer.Name}
+			for k, v := range line.Properties {
+				properties[k] = v
+			}
+			geometry := geojson.LineString(line.Points)
+			if line.Area {
+				geometry = geojson.Polygon(line.Points)
+			}
+			out.Add(geojson.NewFeature(geometry, properties))
+		}
+	}
+	return out
+}
+
+// writeVectorSVG draws vector layers into an SVG. The view box is in
+// world units, with y flipped so north is up, and strokes keep their
+// width no matter how far the image is scaled. It's sized at one
+// pixel per texture pixel.
+func writeVectorSVG(path string, extents MapCoords, layers []*VectorLayer) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("create %q: %w", path, err)
+	}
+	defer f.Close()
+	out := bufio.NewWriter(f)
+
+	fmt.Fprintf(out, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="%d %d %d %d">`+"\n",
+		extents.Width()*gridSize, extents.Height()*gridSize,
+		extents.Left*cellUnits, -(extents.Top+1)*cellUnits,
+		extents.Width()*cellUnits, extents.Height()*cellUnits)
+	for _, layer := range layers {
+		fmt.Fprintf(out, `<g id="%s" fill="none" %s>`+"\n", layer.Name, vectorStyles[layer.Name])
+		for _, line := range layer.Lines {
+			points := make([]string, 0, len(line.Points))
+			for _, p := range line.Points {
+				points = append(points, fmt.Sprintf("%.0f,%.0f", p[0], -p[1]))
+			}
+			element := "polyline"
+			if line.Area {
+				element = "polygon"
+			}
+			fmt.Fprintf(out, `<%s points="%s" vector-effect="non-scaling-stroke"/>`+"\n", element, strings.Join(points, " "))
+		}
+		fmt.Fprintf(out, "</g>\n")
+	}
+	fmt.Fprintf(out, "</svg>\n")
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("write %q: %w", path, err)
+	}
+	return nil
+}
+
+// ExportVectors traces the coastline, and optionally contours, of a
+// load order, and writes them out with the cell grid and submaps.
+func ExportVectors(env *cfg.Environment, opts VectorOptions) error {
+	if opts.SamplesPerCell <= 0 || gridSize%opts.SamplesPerCell != 0 {
+		return fmt.Errorf("samples per cell must divide %d, not %d", gridSize, opts.SamplesPerCell)
+	}
+	fmt.Printf("Parsing %d plugins...\n", len(env.Plugins))
+	parsedLands := NewLandParser(env)
+	if err := parsedLands.ParsePlugins(); err != nil {
+		return fmt.Errorf("parse plugins: %w", err)
+	}
+
+	layers := parsedLands.Vectors(opts)
+	for _, layer := range layers {
+		fmt.Printf("Traced %d %s lines.\n", len(layer.Lines), layer.Name)
+	}
+	if len(opts.GeoJSONPath) > 0 {
+		if err := VectorsGeoJSON(layers).Write(opts.GeoJSONPath); err != nil {
+			return fmt.Errorf("export geojson: %w", err)
+		}
+	}
+	if len(opts.SVGPath) > 0 {
+		if err := writeVectorSVG(opts.SVGPath, parsedLands.MapExtents, layers); err != nil {
+			return fmt.Errorf("export svg: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package hdmap
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectors(t *testing.T) {
+	lp := coneLands()
+	layers := lp.Vectors(VectorOptions{SamplesPerCell: 16, ContourInterval: 400, Tolerance: 64})
+
+	byName := map[string]*VectorLayer{}
+	for _, layer := range layers {
+		byName[layer.Name] = layer
+	}
+	require.Len(t, byName["coastline"].Lines, 1)
+	require.Equal(t, true, byName["coastline"].Lines[0].Properties["closed"])
+	// one loop each at 400 and 800, and none at the coast
+	levels := map[float32]int{}
+	for _, line := range byName["contours"].Lines {
+		levels[line.Properties["height"].(float32)]++
+	}
+	require.Equal(t, 1, levels[400])
+	require.Equal(t, 1, levels[800])
+	require.NotContains(t, levels, float32(0))
+	// 5 lines each way for 4x4 cells
+	require.Len(t, byName["cells"].Lines, 10)
+	require.NotEmpty(t, byName["submaps"].Lines)
+
+	collection := VectorsGeoJSON(layers)
+	total := 0
+	for _, layer := range layers {
+		total += len(layer.Lines)
+	}
+	require.Len(t, collection.Features, total)
+	require.Equal(t, "Polygon", collection.Features[0].Geometry.Type)
+	require.Equal(t, "submaps", collection.Features[0].Properties["layer"])
+
+	path := filepath.Join(t.TempDir(), "map.svg")
+	require.NoError(t, writeVectorSVG(path, lp.MapExtents, layers))
+	raw, err := os.ReadFile(path)
+	require.NoError(t, err)
+	svg := string(raw)
+	require.Contains(t, svg, `viewBox="0 -32768 32768 32768"`)
+	require.Contains(t, svg, `<g id="coastline"`)
+	require.Equal(t, total, strings.Count(svg, "vector-effect"))
+}
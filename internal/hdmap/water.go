@@ -0,0 +1,333 @@
+package hdmap
+
+import (
+	"cmp"
+	"image"
+	"image/color"
+	"math"
+	"slices"
+)
+
+// WaterClass is the kind of water a sample is in.
+type WaterClass uint8
+
+const (
+	Dry WaterClass = iota
+	Ocean
+	Lake
+	River
+)
+
+func (c WaterClass) String() string {
+	switch c {
+	case Ocean:
+		return "ocean"
+	case Lake:
+		return "lake"
+	case River:
+		return "river"
+	default:
+		return "dry"
+	}
+}
+
+const (
+	// waterSamplesPerCell is the resolution water is classified at.
+	waterSamplesPerCell = 32
+	// riverHalfWidth is the widest, in samples from the middle to the
+	// shore, that water can be and still count as a river.
+	riverHalfWidth = 4
+	// riverMinLength is the shortest, in samples, that a narrow channel
+	// can be and still count as a river. Shorter ones are inlets.
+	riverMinLength = waterSamplesPerCell
+	// minWaterBodySamples is the smallest water body that gets listed.
+	minWaterBodySamples = 4
+)
+
+// WaterBody is a connected stretch of one class of water.
+type WaterBody struct {
+	ID    int
+	Class string
+	// Area is in square cells.
+	Area float64
+	// CenterX and CenterY are the world position of the middle of
+	// the body. For odd shapes, this might not be on the water.
+	CenterX float32
+	CenterY float32
+	// MaxDepth is the depth of the deepest sample, in world units.
+	MaxDepth float32
+}
+
+// WaterMap classifies all the water in the map.
+type WaterMap struct {
+	Bodies  []*WaterBody
+	grid    *heightGrid
+	classes []WaterClass
+}
+
+// label finds 4-connected components of samples that share the same
+// non-zero key. It returns a label for each sample, -1 for key 0,
+// and the number of labels.
+func label(width, height int, key func(i int) int) ([]int32, int) {
+	labels := make([]int32, width*height)
+	for i := range labels {
+		labels[i] = -1
+	}
+	count := 0
+	queue := []int{}
+	for start := range labels {
+		k := key(start)
+		if k == 0 || labels[start] >= 0 {
+			continue
+		}
+		labels[start] = int32(count)
+		queue = append(queue[:0], start)
+		for len(queue) > 0 {
+			i := queue[len(queue)-1]
+			queue = queue[:len(queue)-1]
+			x, y := i%width, i/width
+			for _, d := range [4][2]int{{1, 0}, {-1, 0}, {0, 1}, {0, -1}} {
+				nx, ny := x+d[0], y+d[1]
+				if nx < 0 || ny < 0 || nx >= width || ny >= height {
+					continue
+				}
+				n := ny*width + nx
+				if labels[n] < 0 && key(n) == k {
+					labels[n] = int32(count)
+					queue = append(queue, n)
+				}
+			}
+		}
+		count++
+	}
+	return labels, count
+}
+
+// spread does a breadth-first search over 8-connected samples that
+// pass through, starting from the samples where dist is 0. Samples
+// that are reached get their step count in dist, up to limit steps.
+func spread(width, height int, dist []int, through func(i int) bool, limit int) {
+	queue := []int{}
+	for i, d := range dist {
+		if d == 0 {
+			queue = append(queue, i)
+		}
+	}
+	for len(queue) > 0 {
+		i := queue[0]
+		queue = queue[1:]
+		if dist[i] >= limit {
+			continue
+		}
+		x, y := i%width, i/width
+		for dy := -1; dy <= 1; dy++ {
+			for dx := -1; dx <= 1; dx++ {
+				nx, ny := x+dx, y+dy
+				if nx < 0 || ny < 0 || nx >= width || ny >= height {
+					continue
+				}
+				n := ny*width + nx
+				if dist[n] > dist[i]+1 && through(n) {
+					dist[n] = dist[i] + 1
+					queue = append(queue, n)
+				}
+			}
+		}
+	}
+}
+
+// Water separates the ocean, which touches the edge of the map, from
+// lakes, which don't, and from rivers, which are long narrow channels
+// of either.
+func (l *LandParser) Water() *WaterMap {
+	g := newHeightGrid(l, waterSamplesPerCell)
+	w, h := g.width, g.height
+	wet := func(i int) bool { return g.heights[i] < 0 }
+
+	// Connected water that touches the edge of the map is ocean.
+	bodies, count := label(w, h, func(i int) int {
+		if wet(i) {
+			return 1
+		}
+		return 0
+	})
+	oceanic := make([]bool, count)
+	for x := range w {
+		for _, y := range []int{0, h - 1} {
+			if b := bodies[y*w+x]; b >= 0 {
+				oceanic[b] = true
+			}
+		}
+	}
+	for y := range h {
+		for _, x := range []int{0, w - 1} {
+			if b := bodies[y*w+x]; b >= 0 {
+				oceanic[b] = true
+			}
+		}
+	}
+
+	// Find water that's far from shore, and then everything near it.
+	// Whatever water is left over is in a narrow channel.
+	shore := make([]int, w*h)
+	for i := range shore {
+		if wet(i) {
+			shore[i] = math.MaxInt
+		}
+	}
+	spread(w, h, shore, wet, math.MaxInt)
+	open := make([]int, w*h)
+	for i := range open {
+		open[i] = math.MaxInt
+		if wet(i) && shore[i] > riverHalfWidth {
+			open[i] = 0
+		}
+	}
+	spread(w, h, open, wet, riverHalfWidth)
+	narrow := func(i int) bool { return wet(i) && open[i] == math.MaxInt }
+
+	// Narrow channels that are long enough are rivers.
+	channels, channelCount := label(w, h, func(i int) int {
+		if narrow(i) {
+			return 1
+		}
+		return 0
+	})
+	type box struct{ minX, minY, maxX, maxY int }
+	boxes := make([]box, channelCount)
+	for i := range boxes {
+		boxes[i] = box{math.MaxInt, math.MaxInt, -1, -1}
+	}
+	for i, c := range channels {
+		if c >= 0 {
+			b := &boxes[c]
+			x, y := i%w, i/w
+			b.minX, b.minY = min(b.minX, x), min(b.minY, y)
+			b.maxX, b.maxY = max(b.maxX, x), max(b.maxY, y)
+		}
+	}
+
+	out := &WaterMap{grid: g, classes: make([]WaterClass, w*h), Bodies: []*WaterBody{}}
+	for i := range out.classes {
+		switch {
+		case !wet(i):
+			out.classes[i] = Dry
+		case channels[i] >= 0 && max(boxes[channels[i]].maxX-boxes[channels[i]].minX, boxes[channels[i]].maxY-boxes[channels[i]].minY)+1 >= riverMinLength:
+			out.classes[i] = River
+		case oceanic[bodies[i]]:
+			out.classes[i] = Ocean
+		default:
+			out.classes[i] = Lake
+		}
+	}
+
+	// List each connected stretch of the same class.
+	stretches, stretchCount := label(w, h, func(i int) int { return int(out.classes[i]) })
+	sizes := make([]int, stretchCount)
+	sumX := make([]float64, stretchCount)
+	sumY := make([]float64, stretchCount)
+	depths := make([]float32, stretchCount)
+	classes := make([]WaterClass, stretchCount)
+	for i, s := range stretches {
+		if s < 0 {
+			continue
+		}
+		sizes[s]++
+		sumX[s] += float64(i%w) + 0.5
+		sumY[s] += float64(i/w) + 0.5
+		depths[s] = max(depths[s], -g.heights[i])
+		classes[s] = out.classes[i]
+	}
+	for s := range stretchCount {
+		if sizes[s] < minWaterBodySamples {
+			continue
+		}
+		center := g.world(sumX[s]/float64(sizes[s]), sumY[s]/float64(sizes[s]))
+		out.Bodies = append(out.Bodies, &WaterBody{
+			Class:    classes[s].String(),
+			Area:     float64(sizes[s]) / (waterSamplesPerCell * waterSamplesPerCell),
+			CenterX:  float32(center[0]),
+			CenterY:  float32(center[1]),
+			MaxDepth: depths[s],
+		})
+	}
+	slices.SortFunc(out.Bodies, func(a, b *WaterBody) int {
+		return cmp.Or(cmp.Compare(a.Class, b.Class), cmp.Compare(b.Area, a.Area))
+	})
+	for i, body := range out.Bodies {
+		body.ID = i + 1
+	}
+	return out
+}
+
+// classAt finds the class of the water under a pixel of a rendered cell.
+// py is in height order, so it grows to the north.
+func (w *WaterMap) classAt(cx, cy int32, px, py int) WaterClass {
+	x, y := w.grid.sample(cx, cy, px, py)
+	if !w.grid.in(x, y) {
+		return Ocean
+	}
+	return w.classes[y*w.grid.width+x]
+}
+
+// specular is the specular strength of the water under a pixel of a
+// rendered cell. The pixel should be under water.
+func (w *WaterMap) specular(cx, cy int32, px, py int) uint8 {
+	if s, ok := waterSpecular[w.classAt(cx, cy, px, py)]; ok {
+		return s
+	}
+	// The classification is coarser than the render, so shallow
+	// edges can land on a dry sample.
+	return waterSpecular[Ocean]
+}
+
+// waterTints are blended over lakes and rivers so they stand out
+// from the ocean.
+var waterTints = map[WaterClass]color.RGBA{
+	Lake:  {R: 0x40, G: 0x90, B: 0x80, A: 0xff},
+	River: {R: 0x50, G: 0x90, B: 0xc0, A: 0xff},
+}
+
+// waterTint is how strongly lakes and rivers are tinted.
+const waterTint = 0.4
+
+// waterSpecular is the specular strength of each class of water.
+// Still lakes are glossier than the ocean, and rivers are rougher.
+var waterSpecular = map[WaterClass]uint8{
+	Ocean: math.MaxUint8 / 8,
+	Lake:  math.MaxUint8 / 5,
+	River: math.MaxUint8 / 12,
+}
+
+// WaterRenderer tints lakes and rivers over another renderer.
+type WaterRenderer struct {
+	Base  CellRenderer
+	water *WaterMap
+}
+
+func NewWaterRenderer(water *WaterMap, base CellRenderer) *WaterRenderer {
+	return &WaterRenderer{Base: base, water: water}
+}
+
+func (d *WaterRenderer) SetHeightExtents(heightStats Stats, waterHeight float32) {
+	d.Base.SetHeightExtents(heightStats, waterHeight)
+}
+
+func (d *WaterRenderer) Render(p *ParsedLandRecord) *image.RGBA {
+	img := d.Base.Render(p)
+	for y := range gridSize {
+		for x := range gridSize {
+			if p.heights[y][x] >= 0 {
+				continue
+			}
+			tint, ok := waterTints[d.water.classAt(p.x, p.y, x, y)]
+			if !ok {
+				continue
+			}
+			// Need to invert y
+			iy := gridSize - y - 1
+			img.SetRGBA(x, iy, blend(img.RGBAAt(x, iy), tint, waterTint))
+		}
+	}
+	return img
+}
@@ -0,0 +1,101 @@
+package hdmap
+
+import (
+	"image/color"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// waterTestLands makes a 4x4 cell map. wet is called with each
+// sample's position on the global water grid.
+func waterTestLands(wet func(x, y int) bool) *LandParser {
+	l := &LandParser{MapExtents: MapCoords{Left: 0, Bottom: 0, Right: 3, Top: 3}}
+	step := gridSize / waterSamplesPerCell
+	for cx := range int32(4) {
+		for cy := range int32(4) {
+			p := flatLand(cx, cy, 100)
+			for row := range cellVertices {
+				for col := range cellVertices {
+					if wet(int(cx)*waterSamplesPerCell+col/step, int(cy)*waterSamplesPerCell+row/step) {
+						p.heights[row][col] = -100
+					}
+				}
+			}
+			l.Lands = append(l.Lands, p)
+		}
+	}
+	return l
+}
+
+func TestWater(t *testing.T) {
+	lp := waterTestLands(func(x, y int) bool {
+		switch {
+		// ocean along the west edge
+		case x < 16:
+			return true
+		// an enclosed lake
+		case x >= 60 && x < 100 && y >= 60 && y < 100:
+			return true
+		// a long river flowing into the ocean
+		case y >= 20 && y < 24 && x < 110:
+			return true
+		// a short inlet
+		case y >= 40 && y < 44 && x < 26:
+			return true
+		}
+		return false
+	})
+	water := lp.Water()
+
+	class := func(x, y int) WaterClass {
+		return water.classes[y*water.grid.width+x]
+	}
+	require.Equal(t, Ocean, class(5, 64))
+	require.Equal(t, Lake, class(80, 80))
+	require.Equal(t, River, class(80, 21))
+	require.Equal(t, Ocean, class(20, 41))
+	require.Equal(t, Dry, class(50, 50))
+
+	classes := map[string]int{}
+	for _, body := range water.Bodies {
+		classes[body.Class]++
+	}
+	require.Equal(t, map[string]int{"ocean": 1, "lake": 1, "river": 1}, classes)
+	for _, body := range water.Bodies {
+		if body.Class == "lake" {
+			require.InDelta(t, 40.0*40.0/(waterSamplesPerCell*waterSamplesPerCell), body.Area, 0.001)
+			require.InDelta(t, 80.0/waterSamplesPerCell*cellUnits, body.CenterX, 1)
+			require.InDelta(t, 80.0/waterSamplesPerCell*cellUnits, body.CenterY, 1)
+			require.Equal(t, float32(100), body.MaxDepth)
+		}
+	}
+
+	// The lake's east shore is in cell 3,2.
+	var lakeCell *ParsedLandRecord
+	for _, p := range lp.Lands {
+		if p.x == 3 && p.y == 2 {
+			lakeCell = p
+		}
+	}
+	renderer := NewWaterRenderer(water, NewFootprintRenderer(nil, nil))
+	img := renderer.Render(lakeCell)
+	require.NotEqual(t, color.RGBA{}, img.RGBAAt(0, gridSize/2))
+	require.Equal(t, color.RGBA{}, img.RGBAAt(gridSize-1, gridSize/2))
+
+	spec := &SpecularRenderer{Water: water}
+	spec.SetHeightExtents(lp.Heights, 0)
+	require.Equal(t, waterSpecular[Lake], spec.Render(lakeCell).RGBAAt(0, gridSize/2).A)
+	require.Equal(t, uint8(0), spec.Render(lakeCell).RGBAAt(gridSize-1, gridSize/2).A)
+
+	// The sky is at cell 0,0, which has a river, but it's
+	// all ocean.
+	require.NotEqual(t, spec.Render(NewFallbackLandRecord()), spec.withoutWater().Render(NewFallbackLandRecord()))
+	sky := spec.withoutWater().Render(NewFallbackLandRecord())
+	for y := range gridSize {
+		for x := range gridSize {
+			require.Equal(t, waterSpecular[Ocean], sky.RGBAAt(x, y).A)
+		}
+	}
+	require.Same(t, water, spec.Water)
+}
@@ -0,0 +1,268 @@
+// Package preview serves a local web page for checking generated maps
+// and character paths without starting OpenMW.
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/erinpentecost/LivelyMap/internal/dds"
+
+	_ "embed"
+)
+
+//go:embed index.html
+var indexHTML []byte
+
+// textureFolders are the folders that hold map textures, relative to
+// the mod root, keyed by the name the page uses for them.
+var textureFolders = map[string]string{
+	"core":           filepath.Join("00 Core", "textures", "LivelyMap"),
+	"classic":        filepath.Join("01 Classic Map", "textures", "LivelyMap"),
+	"detail":         filepath.Join("01 Detail Map", "textures", "LivelyMap"),
+	"potato":         filepath.Join("01 Potato Map", "textures", "LivelyMap"),
+	"normals":        filepath.Join("02 Normals", "textures", "LivelyMap"),
+	"extremenormals": filepath.Join("02 Extreme Normals", "textures", "LivelyMap"),
+}
+
+// dataFolder holds maps.json and the paths folder, relative to the
+// mod root.
+var dataFolder = filepath.Join("00 Core", "scripts", "LivelyMap", "data")
+
+// decodedTexture is a texture that's already been turned into a PNG.
+type decodedTexture struct {
+	modTime time.Time
+	png     []byte
+}
+
+// Server serves the preview page and the files it reads.
+type Server struct {
+	root string
+	mux  *http.ServeMux
+
+	cacheMux sync.Mutex
+	cache    map[string]*decodedTexture
+}
+
+// NewServer makes a server for the LivelyMap install at root.
+func NewServer(root string) *Server {
+	s := &Server{
+		root:  root,
+		mux:   http.NewServeMux(),
+		cache: map[string]*decodedTexture{},
+	}
+	s.mux.HandleFunc("GET /{$}", s.index)
+	s.mux.HandleFunc("GET /api/maps", s.maps)
+	s.mux.HandleFunc("GET /api/textures", s.textures)
+	s.mux.HandleFunc("GET /api/paths", s.paths)
+	s.mux.HandleFunc("GET /api/paths/{name}", s.path)
+	s.mux.HandleFunc("GET /api/version", s.version)
+	s.mux.HandleFunc("GET /textures/{folder}/{name}", s.texture)
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(raw)
+}
+
+// serveFile sends a file from the mod root. Missing files are 404s.
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, path string, contentType string) {
+	raw, err := os.ReadFile(filepath.Join(s.root, path))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(raw)
+}
+
+// safeName is true if name is a plain file name, with no way to
+// reach outside of its folder.
+func safeName(name string) bool {
+	return len(name) > 0 && name == filepath.Base(name) && name != "." && name != ".." && !strings.ContainsAny(name, `/\`)
+}
+
+func (s *Server) index(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write(indexHTML)
+}
+
+func (s *Server) maps(w http.ResponseWriter, r *http.Request) {
+	s.serveFile(w, r, filepath.Join(dataFolder, "maps.json"), "application/json")
+}
+
+// listFiles lists the names of the files in dir with ext, sorted.
+// A missing folder has no files.
+func listFiles(dir string, ext string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	out := []string{}
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.EqualFold(filepath.Ext(entry.Name()), ext) {
+			out = append(out, entry.Name())
+		}
+	}
+	slices.Sort(out)
+	return out, nil
+}
+
+func (s *Server) textures(w http.ResponseWriter, r *http.Request) {
+	out := map[string][]string{}
+	for name, folder := range textureFolders {
+		files, err := listFiles(filepath.Join(s.root, folder), ".dds")
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if len(files) > 0 {
+			out[name] = files
+		}
+	}
+	writeJSON(w, out)
+}
+
+func (s *Server) texture(w http.ResponseWriter, r *http.Request) {
+	folder, ok := textureFolders[r.PathValue("folder")]
+	name := r.PathValue("name")
+	if !ok || !safeName(name) || !strings.EqualFold(filepath.Ext(name), ".dds") {
+		http.NotFound(w, r)
+		return
+	}
+	img, err := s.decode(filepath.Join(s.root, folder, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "image/png")
+	w.Write(img)
+}
+
+// decode turns a DDS texture into a PNG. Textures are only decoded
+// again when they change.
+func (s *Server) decode(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	s.cacheMux.Lock()
+	cached, ok := s.cache[path]
+	s.cacheMux.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) {
+		return cached.png, nil
+	}
+
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	img, err := dds.Decode(raw)
+	if err != nil {
+		return nil, fmt.Errorf("decode %q: %w", path, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, img); err != nil {
+		return nil, fmt.Errorf("encode %q: %w", path, err)
+	}
+	s.cacheMux.Lock()
+	defer s.cacheMux.Unlock()
+	s.cache[path] = &decodedTexture{modTime: info.ModTime(), png: buf.Bytes()}
+	return buf.Bytes(), nil
+}
+
+func (s *Server) paths(w http.ResponseWriter, r *http.Request) {
+	files, err := listFiles(filepath.Join(s.root, dataFolder, "paths"), ".json")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	names := make([]string, 0, len(files))
+	for _, file := range files {
+		names = append(names, strings.TrimSuffix(file, filepath.Ext(file)))
+	}
+	writeJSON(w, names)
+}
+
+func (s *Server) path(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("name")
+	if !safeName(name + ".json") {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveFile(w, r, filepath.Join(dataFolder, "paths", name+".json"), "application/json")
+}
+
+// Version is the time of the newest change to maps.json, the paths,
+// or the textures. The page reloads when it changes.
+func (s *Server) Version() (time.Time, error) {
+	newest := time.Time{}
+	dirs := []string{filepath.Join(s.root, dataFolder), filepath.Join(s.root, dataFolder, "paths")}
+	for _, folder := range textureFolders {
+		dirs = append(dirs, filepath.Join(s.root, folder))
+	}
+	for _, dir := range dirs {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return newest, fmt.Errorf("read dir %q: %w", dir, err)
+		}
+		for _, entry := range entries {
+			info, err := entry.Info()
+			if err != nil {
+				// Files come and go during a sync.
+				if errors.Is(err, fs.ErrNotExist) {
+					continue
+				}
+				return newest, fmt.Errorf("stat %q: %w", entry.Name(), err)
+			}
+			if !info.IsDir() && info.ModTime().After(newest) {
+				newest = info.ModTime()
+			}
+		}
+	}
+	return newest, nil
+}
+
+func (s *Server) version(w http.ResponseWriter, r *http.Request) {
+	v, err := s.Version()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	writeJSON(w, map[string]int64{"Version": v.UnixNano()})
+}
@@ -0,0 +1,82 @@
+package preview
+
+import (
+	"bytes"
+	"encoding/json"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/erinpentecost/LivelyMap/internal/dds"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, s *Server, url string) *httptest.ResponseRecorder {
+	t.Helper()
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, httptest.NewRequest(http.MethodGet, url, nil))
+	return w
+}
+
+func TestServer(t *testing.T) {
+	root := t.TempDir()
+	data := filepath.Join(root, dataFolder)
+	require.NoError(t, os.MkdirAll(filepath.Join(data, "paths"), 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "maps.json"), []byte(`{"Maps":{"1":{"ID":1}}}`), 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(data, "paths", "hero.json"), []byte(`{"id":"hero","paths":[]}`), 0666))
+
+	classic := filepath.Join(root, textureFolders["classic"])
+	require.NoError(t, os.MkdirAll(classic, 0777))
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	img.SetRGBA(1, 2, color.RGBA{R: 0xff, A: 0xff})
+	f, err := os.Create(filepath.Join(classic, "world_1.dds"))
+	require.NoError(t, err)
+	require.NoError(t, dds.Encode(f, img, dds.Lossless))
+	require.NoError(t, f.Close())
+
+	s := NewServer(root)
+
+	w := get(t, s, "/")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.Contains(t, w.Body.String(), "LivelyMap Preview")
+
+	w = get(t, s, "/api/maps")
+	require.Equal(t, http.StatusOK, w.Code)
+	require.JSONEq(t, `{"Maps":{"1":{"ID":1}}}`, w.Body.String())
+
+	w = get(t, s, "/api/textures")
+	require.JSONEq(t, `{"classic":["world_1.dds"]}`, w.Body.String())
+
+	w = get(t, s, "/api/paths")
+	require.JSONEq(t, `["hero"]`, w.Body.String())
+	w = get(t, s, "/api/paths/hero")
+	require.JSONEq(t, `{"id":"hero","paths":[]}`, w.Body.String())
+	require.Equal(t, http.StatusNotFound, get(t, s, "/api/paths/nobody").Code)
+	require.Equal(t, http.StatusNotFound, get(t, s, "/api/paths/..%2Fmaps").Code)
+
+	w = get(t, s, "/textures/classic/world_1.dds")
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	require.Equal(t, "image/png", w.Header().Get("Content-Type"))
+	decoded, err := png.Decode(bytes.NewReader(w.Body.Bytes()))
+	require.NoError(t, err)
+	require.Equal(t, color.RGBA{R: 0xff, A: 0xff}, color.RGBAModel.Convert(decoded.At(1, 2)))
+	require.Equal(t, http.StatusNotFound, get(t, s, "/textures/classic/world_2.dds").Code)
+	require.Equal(t, http.StatusNotFound, get(t, s, "/textures/nowhere/world_1.dds").Code)
+
+	// The version moves forward when a sync writes new files.
+	version := func() int64 {
+		out := map[string]int64{}
+		require.NoError(t, json.Unmarshal(get(t, s, "/api/version").Body.Bytes(), &out))
+		return out["Version"]
+	}
+	before := version()
+	later := time.Now().Add(time.Hour)
+	require.NoError(t, os.Chtimes(filepath.Join(data, "paths", "hero.json"), later, later))
+	require.Greater(t, version(), before)
+}
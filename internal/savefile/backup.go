@@ -0,0 +1,191 @@
+package savefile
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ernmw/omwpacker/esm"
+)
+
+// DefaultBackups is the number of backups kept for each save.
+const DefaultBackups = 5
+
+// backupTimeFormat is the timestamp in backup file names. It sorts
+// in time order.
+const backupTimeFormat = "20060102-150405.000"
+
+// backupPrefix is the start of the names of the backups of savePath.
+func backupPrefix(savePath string) string {
+	return strings.TrimSuffix(filepath.Base(savePath), filepath.Ext(savePath)) + "."
+}
+
+// Backups lists the backups of a save, newest first.
+func Backups(savePath string) ([]string, error) {
+	dir := filepath.Dir(savePath)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	prefix := backupPrefix(savePath)
+	out := []string{}
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasPrefix(name, prefix) || !strings.HasSuffix(name, ".bak") {
+			continue
+		}
+		stamp := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".bak")
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		out = append(out, filepath.Join(dir, name))
+	}
+	slices.Sort(out)
+	slices.Reverse(out)
+	return out, nil
+}
+
+// backupSave writes contents to a timestamped backup next to the save,
+// then deletes all but the newest keep backups.
+func backupSave(savePath string, contents []byte, now time.Time, keep int) (string, error) {
+	backupPath, err := writeBackup(savePath, contents, now)
+	if err != nil {
+		return "", err
+	}
+	if err := pruneBackups(savePath, keep, ""); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
+
+// writeBackup writes contents to a timestamped backup next to the save.
+func writeBackup(savePath string, contents []byte, now time.Time) (string, error) {
+	backupPath := filepath.Join(filepath.Dir(savePath), backupPrefix(savePath)+now.Format(backupTimeFormat)+".bak")
+	if err := replaceFile(backupPath, func(w io.Writer) error {
+		_, err := w.Write(contents)
+		return err
+	}, nil); err != nil {
+		return "", fmt.Errorf("back up %q to %q: %w", savePath, backupPath, err)
+	}
+	return backupPath, nil
+}
+
+// pruneBackups deletes all but the newest keep backups of a save. The
+// backup at spare is never deleted, even if it's older.
+func pruneBackups(savePath string, keep int, spare string) error {
+	backups, err := Backups(savePath)
+	if err != nil {
+		return err
+	}
+	for _, old := range backups[min(max(keep, 1), len(backups)):] {
+		if len(spare) > 0 && filepath.Clean(old) == filepath.Clean(spare) {
+			continue
+		}
+		if err := os.Remove(old); err != nil {
+			return fmt.Errorf("remove old backup %q: %w", old, err)
+		}
+	}
+	return nil
+}
+
+// replaceFile writes a temporary file next to path, and then renames
+// it over path so that path is never half written. If verify is set,
+// the temporary file is read back, parsed, and checked before the
+// rename.
+func replaceFile(path string, write func(w io.Writer) error, verify func(written []byte, records []*esm.Record) error) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file for %q: %w", path, err)
+	}
+	// This fails harmlessly once the file is renamed.
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	out := bufio.NewWriter(tmp)
+	if err := write(out); err != nil {
+		return fmt.Errorf("write %q: %w", tmp.Name(), err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("write %q: %w", tmp.Name(), err)
+	}
+	if err := tmp.Sync(); err != nil {
+		return fmt.Errorf("sync %q: %w", tmp.Name(), err)
+	}
+
+	if verify != nil {
+		written, err := os.ReadFile(tmp.Name())
+		if err != nil {
+			return fmt.Errorf("read %q: %w", tmp.Name(), err)
+		}
+		records, err := esm.ParsePluginData("savefile", bytes.NewReader(written))
+		if err != nil {
+			return fmt.Errorf("parse %q: %w", tmp.Name(), err)
+		}
+		if err := verify(written, records); err != nil {
+			return fmt.Errorf("verify %q: %w", tmp.Name(), err)
+		}
+	}
+
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("close %q: %w", tmp.Name(), err)
+	}
+	if info, err := os.Stat(path); err == nil {
+		if err := os.Chmod(tmp.Name(), info.Mode().Perm()); err != nil {
+			return fmt.Errorf("set mode of %q: %w", tmp.Name(), err)
+		}
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("rename %q to %q: %w", tmp.Name(), path, err)
+	}
+	return nil
+}
+
+// Restore replaces a save with one of its backups, or with the newest
+// one if backupPath is empty. The save is backed up before it's
+// replaced, so a restore can be undone. Old backups are only pruned
+// once the restore is done, and never the one restored from.
+func Restore(savePath string, backupPath string, keep int) (string, error) {
+	if len(backupPath) == 0 {
+		backups, err := Backups(savePath)
+		if err != nil {
+			return "", err
+		}
+		if len(backups) == 0 {
+			return "", fmt.Errorf("no backups of %q", savePath)
+		}
+		backupPath = backups[0]
+	}
+	contents, err := os.ReadFile(backupPath)
+	if err != nil {
+		return "", fmt.Errorf("read backup %q: %w", backupPath, err)
+	}
+	if _, err := esm.ParsePluginData("savefile", bytes.NewReader(contents)); err != nil {
+		return "", fmt.Errorf("parse backup %q: %w", backupPath, err)
+	}
+
+	if current, err := os.ReadFile(savePath); err == nil {
+		if _, err := writeBackup(savePath, current, time.Now()); err != nil {
+			return "", err
+		}
+	} else if !os.IsNotExist(err) {
+		return "", fmt.Errorf("read %q: %w", savePath, err)
+	}
+
+	if err := replaceFile(savePath, func(w io.Writer) error {
+		_, err := w.Write(contents)
+		return err
+	}, nil); err != nil {
+		return "", fmt.Errorf("restore %q: %w", savePath, err)
+	}
+	// The backup that was restored is kept, even if it's the oldest.
+	if err := pruneBackups(savePath, keep, backupPath); err != nil {
+		return "", err
+	}
+	return backupPath, nil
+}
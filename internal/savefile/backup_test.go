@@ -0,0 +1,144 @@
+package savefile
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/stretchr/testify/require"
+)
+
+// copySave copies the test save into a temp folder.
+func copySave(t *testing.T) (string, []byte) {
+	t.Helper()
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), "test.omwsave")
+	require.NoError(t, os.WriteFile(path, original, 0640))
+	return path, original
+}
+
+func TestExtractAndRestore(t *testing.T) {
+	path, original := copySave(t)
+
+	data, err := ExtractData(path, 2)
+	require.NoError(t, err)
+	require.Equal(t, "erintestcharacter", data.Player)
+
+	extracted, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.False(t, bytes.Contains(extracted, []byte(magic_prefix)))
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0640), info.Mode().Perm())
+
+	backups, err := Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 1)
+	backup, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	require.Equal(t, original, backup)
+
+	// There's nothing left to extract, and the save isn't touched.
+	_, err = ExtractData(path, 2)
+	require.Error(t, err)
+	unchanged, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, extracted, unchanged)
+
+	restored, err := Restore(path, "", 2)
+	require.NoError(t, err)
+	require.Equal(t, backups[0], restored)
+	current, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, original, current)
+	// The extracted save was backed up before it was replaced.
+	backups, err = Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	newest, err := os.ReadFile(backups[0])
+	require.NoError(t, err)
+	require.Equal(t, extracted, newest)
+
+	// No temp files are left behind.
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 3)
+}
+
+func TestBackupRotation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.omwsave")
+	start := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := range 4 {
+		_, err := backupSave(path, []byte{byte(i)}, start.Add(time.Duration(i)*time.Minute), 3)
+		require.NoError(t, err)
+	}
+	// Other files that look like backups are left alone.
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "test.bak"), nil, 0666))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(path), "test.other.bak"), nil, 0666))
+
+	backups, err := Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+	require.Equal(t, "test.20260102-030705.000.bak", filepath.Base(backups[0]))
+	require.Equal(t, "test.20260102-030505.000.bak", filepath.Base(backups[2]))
+}
+
+func TestRestoreOldestBackup(t *testing.T) {
+	path, original := copySave(t)
+	start := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	oldest, err := backupSave(path, original, start, 2)
+	require.NoError(t, err)
+	_, err = backupSave(path, original, start.Add(time.Minute), 2)
+	require.NoError(t, err)
+
+	// Restoring makes a third backup, but the one being restored from
+	// isn't pruned.
+	restored, err := Restore(path, oldest, 2)
+	require.NoError(t, err)
+	require.Equal(t, oldest, restored)
+	backups, err := Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 3)
+	require.Equal(t, oldest, backups[2])
+
+	// It goes the next time backups are pruned.
+	_, err = backupSave(path, original, time.Now().Add(time.Minute), 2)
+	require.NoError(t, err)
+	backups, err = Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.NotContains(t, backups, oldest)
+}
+
+func TestVerifyRewrite(t *testing.T) {
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
+	require.NoError(t, err)
+	_, err = extractRecord(records)
+	require.NoError(t, err)
+	buf := &bytes.Buffer{}
+	require.NoError(t, esm.WriteRecords(buf, slices.Values(records)))
+	rewritten := buf.Bytes()
+	require.NoError(t, verifyRewrite(original, rewritten))
+	require.NoError(t, verifyRewrite(original, original))
+
+	// Nothing else can change, even if it would parse the same.
+	split, err := rawRecords(rewritten)
+	require.NoError(t, err)
+	require.Greater(t, len(split), 3)
+	offset := len(slices.Concat(split[:3]...))
+	changed := slices.Clone(rewritten)
+	changed[offset+recordHeaderLen+subrecordHeaderLen]++
+	require.ErrorContains(t, verifyRewrite(original, changed), "record 3")
+	changed = slices.Clone(rewritten)
+	changed[offset+8]++
+	require.ErrorContains(t, verifyRewrite(original, changed), "record 3")
+	require.Error(t, verifyRewrite(original, rewritten[len(split[0]):]))
+	require.Error(t, verifyRewrite(original, rewritten[:len(rewritten)-1]))
+}
@@ -0,0 +1,111 @@
+package savefile
+
+import (
+	"cmp"
+	"slices"
+)
+
+// Branch is a timeline that split off from a character's main one,
+// because the player reloaded an older save and played on from it.
+type Branch struct {
+	// Save is the name of the save the branch was found in, or of the
+	// path file if a newer save cut it off from there.
+	Save string `json:"save"`
+	// Fork is the time of the last entry the branch shares with the
+	// main timeline, or 0 if it shares none.
+	Fork  uint64       `json:"fork"`
+	Paths []*PathEntry `json:"paths"`
+}
+
+// reconcile merges the path data of an older save into canonical,
+// which holds the main timeline.
+//
+// Entries from before canonical starts are history that canonical is
+// missing, so they're added to it. The rest of the save's entries
+// should already be in canonical. If they aren't, the save is on a
+// different timeline, and everything from the first entry that isn't
+// is returned as a branch. If canonical has been simplified, entries
+// within slack of it count as being in it.
+func reconcile(canonical *SaveData, other *SaveData, slack float64) (*SaveData, *Branch) {
+	if len(canonical.Paths) == 0 {
+		return &SaveData{Player: canonical.Player, Paths: other.Paths, Branches: canonical.Branches, Extra: canonical.Extra}, nil
+	}
+	first := canonical.Paths[0].TimeStamp
+	split := 0
+	for split < len(other.Paths) && other.Paths[split].TimeStamp < first {
+		split++
+	}
+	merged := canonical
+	if split > 0 {
+		merged = &SaveData{
+			Player:   canonical.Player,
+			Paths:    slices.Concat(other.Paths[:split], canonical.Paths),
+			Branches: canonical.Branches,
+			Extra:    canonical.Extra,
+		}
+	}
+
+	known := map[PathEntry]bool{}
+	for _, entry := range canonical.Paths {
+		known[unmarked(entry)] = true
+	}
+	near := func(entry *PathEntry) bool {
+		if slack <= 0 {
+			return false
+		}
+		// The canonical entries on either side of it in time.
+		j, _ := slices.BinarySearchFunc(canonical.Paths, entry.TimeStamp, func(e *PathEntry, t uint64) int {
+			return cmp.Compare(e.TimeStamp, t)
+		})
+		if j == 0 || j == len(canonical.Paths) {
+			return false
+		}
+		return segmentDistance(entry, canonical.Paths[j-1], canonical.Paths[j]) <= slack
+	}
+	for i := split; i < len(other.Paths); i++ {
+		if known[unmarked(other.Paths[i])] || near(other.Paths[i]) {
+			continue
+		}
+		branch := &Branch{Paths: slices.Clone(other.Paths[i:])}
+		if i > 0 {
+			branch.Fork = other.Paths[i-1].TimeStamp
+		}
+		return merged, branch
+	}
+	return merged, nil
+}
+
+// unmarked is entry without its Teleport mark, which only extracted
+// entries have.
+func unmarked(entry *PathEntry) PathEntry {
+	out := *entry
+	out.Teleport = false
+	return out
+}
+
+// hasPrefix is true if prefix is the start of paths.
+func hasPrefix(paths []*PathEntry, prefix []*PathEntry) bool {
+	return len(prefix) <= len(paths) && slices.EqualFunc(paths[:len(prefix)], prefix, func(a, b *PathEntry) bool {
+		return unmarked(a) == unmarked(b)
+	})
+}
+
+// addBranch adds b to branches. Saves made further along the same
+// branch hold everything the earlier ones do, so only the longest
+// copy of a branch is kept.
+func addBranch(branches []*Branch, b *Branch) []*Branch {
+	for i, existing := range branches {
+		if existing.Fork != b.Fork {
+			continue
+		}
+		if hasPrefix(existing.Paths, b.Paths) {
+			return branches
+		}
+		if hasPrefix(b.Paths, existing.Paths) {
+			out := slices.Clone(branches)
+			out[i] = b
+			return out
+		}
+	}
+	return append(slices.Clone(branches), b)
+}
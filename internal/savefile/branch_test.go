@@ -0,0 +1,164 @@
+package savefile
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func times(entries []*PathEntry) []uint64 {
+	out := []uint64{}
+	for _, entry := range entries {
+		out = append(out, entry.TimeStamp)
+	}
+	return out
+}
+
+func TestReconcile(t *testing.T) {
+	canonical := &SaveData{Player: "p", Paths: []*PathEntry{pe(5), pe(6), pe(7), pe(8)}}
+
+	// An older save on the same timeline adds nothing.
+	merged, branch := reconcile(canonical, &SaveData{Player: "p", Paths: []*PathEntry{pe(5), pe(6)}}, 0)
+	require.Nil(t, branch)
+	require.Equal(t, []uint64{5, 6, 7, 8}, times(merged.Paths))
+
+	// History from before the main timeline starts is kept.
+	merged, branch = reconcile(canonical, &SaveData{Player: "p", Paths: []*PathEntry{pe(3), pe(4), pe(5)}}, 0)
+	require.Nil(t, branch)
+	require.Equal(t, []uint64{3, 4, 5, 6, 7, 8}, times(merged.Paths))
+
+	// A save that went somewhere else after 6 is a branch.
+	elsewhere := &PathEntry{TimeStamp: 7, Xposition: 100}
+	merged, branch = reconcile(canonical, &SaveData{Player: "p", Paths: []*PathEntry{pe(5), pe(6), elsewhere, pe(9)}}, 0)
+	require.Equal(t, canonical, merged)
+	require.NotNil(t, branch)
+	require.Equal(t, uint64(6), branch.Fork)
+	require.Equal(t, []uint64{7, 9}, times(branch.Paths))
+	require.Equal(t, elsewhere, branch.Paths[0])
+
+	// Entries that a simplified path dropped are still on it.
+	simplified := &SaveData{Player: "p", Paths: []*PathEntry{pe(5), {TimeStamp: 8, Xposition: 300}}}
+	_, branch = reconcile(simplified, &SaveData{Player: "p", Paths: []*PathEntry{pe(5), {TimeStamp: 6, Xposition: 100}}}, 10)
+	require.Nil(t, branch)
+	_, branch = reconcile(simplified, &SaveData{Player: "p", Paths: []*PathEntry{pe(5), {TimeStamp: 6, Xposition: 100, Yposition: 50}}}, 10)
+	require.NotNil(t, branch)
+}
+
+func TestAddBranch(t *testing.T) {
+	short := &Branch{Save: "a", Fork: 6, Paths: []*PathEntry{pe(7)}}
+	long := &Branch{Save: "b", Fork: 6, Paths: []*PathEntry{pe(7), pe(8)}}
+	other := &Branch{Save: "c", Fork: 2, Paths: []*PathEntry{pe(3)}}
+
+	branches := addBranch(nil, short)
+	branches = addBranch(branches, long)
+	require.Equal(t, []*Branch{long}, branches)
+	branches = addBranch(branches, short)
+	require.Equal(t, []*Branch{long}, branches)
+	branches = addBranch(branches, other)
+	require.Equal(t, []*Branch{long, other}, branches)
+}
+
+func TestExtractCharacterAllSaves(t *testing.T) {
+	root := t.TempDir()
+	characterDir := filepath.Join(t.TempDir(), "erintestcharacter")
+	require.NoError(t, os.MkdirAll(characterDir, 0777))
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	older := filepath.Join(characterDir, "1.omwsave")
+	newer := filepath.Join(characterDir, "2.omwsave")
+	for i, path := range []string{older, newer} {
+		require.NoError(t, os.WriteFile(path, original, 0666))
+		written := time.Now().Add(time.Duration(i-2) * time.Hour)
+		require.NoError(t, os.Chtimes(path, written, written))
+	}
+	require.NoError(t, os.MkdirAll(filepath.Join(root, PathsDir), 0777))
+
+	// Only the newest save is read by default.
+	report, err := extractCharacter(root, characterDir, nil, ExtractOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Saves)
+	require.Equal(t, newer, report.Save)
+
+	report, err = extractCharacter(root, characterDir, nil, ExtractOptions{AllSaves: true, Backups: 1})
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Saves)
+	require.Equal(t, newer, report.Save)
+	require.Zero(t, report.Branches)
+	for _, path := range []string{older, newer} {
+		_, err := readSave(path)
+		require.ErrorIs(t, err, ErrNoData)
+	}
+
+	// There's nothing left to extract.
+	report, err = extractCharacter(root, characterDir, nil, ExtractOptions{AllSaves: true, Backups: 1})
+	require.NoError(t, err)
+	require.Nil(t, report)
+}
+
+func TestReconcileTeleports(t *testing.T) {
+	// The path file's entries are marked, but the save's aren't yet.
+	marked := &PathEntry{TimeStamp: 2, Xposition: 10 * cellUnits, Teleport: true}
+	canonical := &SaveData{Player: "p", Paths: []*PathEntry{at(1, 100, 100), marked}}
+	unmarkedCopy := unmarked(marked)
+	_, branch := reconcile(canonical, &SaveData{Player: "p", Paths: []*PathEntry{at(1, 100, 100), &unmarkedCopy}}, 0)
+	require.Nil(t, branch)
+}
+
+func TestExtractCharacterReload(t *testing.T) {
+	root := t.TempDir()
+	characterDir := filepath.Join(t.TempDir(), "erintestcharacter")
+	require.NoError(t, os.MkdirAll(characterDir, 0777))
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	savePath := filepath.Join(characterDir, "1.omwsave")
+	require.NoError(t, os.WriteFile(savePath, original, 0666))
+	fromSave, err := readSave(savePath)
+	require.NoError(t, err)
+
+	// The path file went on from the save's first entry, but then the
+	// player reloaded and took another road.
+	first := *fromSave.data.Paths[0]
+	lost := []*PathEntry{
+		{TimeStamp: first.TimeStamp + 100, Xposition: 5000, Yposition: 5000},
+		{TimeStamp: first.TimeStamp + 10000, Xposition: 6000, Yposition: 5000},
+	}
+	existing, err := json.Marshal(&SaveData{
+		Player: fromSave.data.Player,
+		Paths:  slices.Concat([]*PathEntry{&first}, lost),
+	})
+	require.NoError(t, err)
+	pathsDir := filepath.Join(root, PathsDir)
+	require.NoError(t, os.MkdirAll(pathsDir, 0777))
+	pathFile := filepath.Join(pathsDir, "erintestcharacter.json")
+	require.NoError(t, os.WriteFile(pathFile, existing, 0666))
+
+	// Without -branches, nothing is thrown away.
+	report, err := extractCharacter(root, characterDir, nil, ExtractOptions{Backups: 1})
+	require.NoError(t, err)
+	require.Nil(t, report)
+	unchanged, err := os.ReadFile(pathFile)
+	require.NoError(t, err)
+	require.Equal(t, existing, unchanged)
+	current, err := os.ReadFile(savePath)
+	require.NoError(t, err)
+	require.Equal(t, original, current)
+
+	// With it, the cut off entries are archived.
+	report, err = extractCharacter(root, characterDir, nil, ExtractOptions{Backups: 1, Branches: true})
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Branches)
+	written, err := os.ReadFile(pathFile)
+	require.NoError(t, err)
+	data, err := Unmarshal(written)
+	require.NoError(t, err)
+	require.Equal(t, times(fromSave.data.Paths), times(data.Paths))
+	require.Len(t, data.Branches, 1)
+	require.Equal(t, "erintestcharacter.json", data.Branches[0].Save)
+	require.Equal(t, first.TimeStamp, data.Branches[0].Fork)
+	require.Equal(t, lost, data.Branches[0].Paths)
+}
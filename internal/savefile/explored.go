@@ -0,0 +1,296 @@
+package savefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"math"
+	"os"
+	"path/filepath"
+
+	"github.com/ernmw/omwpacker/cfg"
+	"github.com/ernmw/omwpacker/esm"
+)
+
+// GMAP is the save record that holds the vanilla global map's
+// explored areas.
+const GMAP = esm.RecordTag("GMAP")
+
+// cellUnits is the width of a cell, in world units.
+const cellUnits = 8192
+
+// DefaultExploredPixels is the default number of pixels along the edge
+// of a cell in an explored mask.
+const DefaultExploredPixels = 16
+
+// ExploredDir is where explored masks are kept, relative to the mod
+// root.
+var ExploredDir = filepath.Join("00 Core", "scripts", "LivelyMap", "data", "explored")
+
+// Extents are the cells at the edges of a map, inclusive.
+type Extents struct {
+	Top    int32
+	Bottom int32
+	Left   int32
+	Right  int32
+}
+
+// ExploredMap is a mask of the cells a character has explored. Row 0
+// of the mask is the top edge of the top cells, and each cell is
+// PixelsPerCell pixels wide and tall.
+type ExploredMap struct {
+	Extents       Extents
+	PixelsPerCell int
+	// Markers are the cells OpenMW lists as explored.
+	Markers [][2]int32   `json:",omitempty"`
+	Mask    *image.Alpha `json:"-"`
+}
+
+// parseGlobalMap reads the GMAP record, which OpenMW writes in
+// components/esm3/globalmap.cpp. Its DATA is a PNG of the explored
+// overlay, with the northmost cells at the top.
+func parseGlobalMap(records []*esm.Record) (*ExploredMap, error) {
+	for _, rec := range records {
+		if rec.Tag != GMAP {
+			continue
+		}
+		out := &ExploredMap{}
+		for _, sub := range rec.Subrecords {
+			switch sub.Tag {
+			case "BNDS":
+				var bounds [4]int32 // min x, max x, min y, max y
+				if err := binary.Read(bytes.NewReader(sub.Data), binary.LittleEndian, &bounds); err != nil {
+					return nil, fmt.Errorf("parse BNDS subrecord: %w", err)
+				}
+				out.Extents = Extents{Left: bounds[0], Right: bounds[1], Bottom: bounds[2], Top: bounds[3]}
+			case "DATA":
+				img, err := png.Decode(bytes.NewReader(sub.Data))
+				if err != nil {
+					return nil, fmt.Errorf("decode global map image: %w", err)
+				}
+				b := img.Bounds()
+				out.Mask = image.NewAlpha(image.Rect(0, 0, b.Dx(), b.Dy()))
+				for y := range b.Dy() {
+					for x := range b.Dx() {
+						_, _, _, a := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+						out.Mask.Pix[out.Mask.PixOffset(x, y)] = uint8(a >> 8)
+					}
+				}
+			case "MRK_":
+				var cell [2]int32
+				if err := binary.Read(bytes.NewReader(sub.Data), binary.LittleEndian, &cell); err != nil {
+					return nil, fmt.Errorf("parse MRK_ subrecord: %w", err)
+				}
+				out.Markers = append(out.Markers, cell)
+			}
+		}
+		if out.Mask == nil {
+			return nil, fmt.Errorf("GMAP record has no image")
+		}
+		width := int(out.Extents.Right - out.Extents.Left + 1)
+		height := int(out.Extents.Top - out.Extents.Bottom + 1)
+		if width <= 0 || height <= 0 || out.Mask.Rect.Dx()%width != 0 || out.Mask.Rect.Dy()%height != 0 ||
+			out.Mask.Rect.Dx()/width != out.Mask.Rect.Dy()/height {
+			return nil, fmt.Errorf("%v global map image doesn't fit bounds %+v", out.Mask.Rect.Size(), out.Extents)
+		}
+		out.PixelsPerCell = out.Mask.Rect.Dx() / width
+		return out, nil
+	}
+	return nil, fmt.Errorf("didn't find the GMAP record")
+}
+
+// Reproject resamples the mask onto a grid with other extents and
+// pixelsPerCell pixels per cell. Cells outside of the mask are
+// unexplored.
+func (e *ExploredMap) Reproject(extents Extents, pixelsPerCell int) *ExploredMap {
+	width := int(extents.Right-extents.Left+1) * pixelsPerCell
+	height := int(extents.Top-extents.Bottom+1) * pixelsPerCell
+	out := &ExploredMap{
+		Extents:       extents,
+		PixelsPerCell: pixelsPerCell,
+		Markers:       e.Markers,
+		Mask:          image.NewAlpha(image.Rect(0, 0, width, height)),
+	}
+	// source is the pixel in e for the middle of a destination pixel,
+	// with offset being the cell distance between the top left corners.
+	source := func(dst int, offset int32) int {
+		cells := (float64(dst) + 0.5) / float64(pixelsPerCell)
+		return int(math.Floor((cells + float64(offset)) * float64(e.PixelsPerCell)))
+	}
+	for y := range height {
+		sy := source(y, e.Extents.Top-extents.Top)
+		if sy < 0 || sy >= e.Mask.Rect.Dy() {
+			continue
+		}
+		for x := range width {
+			sx := source(x, extents.Left-e.Extents.Left)
+			if sx < 0 || sx >= e.Mask.Rect.Dx() {
+				continue
+			}
+			out.Mask.Pix[out.Mask.PixOffset(x, y)] = e.Mask.Pix[e.Mask.PixOffset(sx, sy)]
+		}
+	}
+	return out
+}
+
+// AddPaths marks every cell a path entry is in as explored. Entries
+// without a position are skipped.
+func (e *ExploredMap) AddPaths(paths []*PathEntry) {
+	for _, entry := range paths {
+		if !hasPosition(entry) {
+			continue
+		}
+		cx := int32(math.Floor(entry.Xposition / cellUnits))
+		cy := int32(math.Floor(entry.Yposition / cellUnits))
+		if cx < e.Extents.Left || cx > e.Extents.Right || cy < e.Extents.Bottom || cy > e.Extents.Top {
+			continue
+		}
+		left := int(cx-e.Extents.Left) * e.PixelsPerCell
+		top := int(e.Extents.Top-cy) * e.PixelsPerCell
+		for y := top; y < top+e.PixelsPerCell; y++ {
+			for x := left; x < left+e.PixelsPerCell; x++ {
+				e.Mask.Pix[e.Mask.PixOffset(x, y)] = math.MaxUint8
+			}
+		}
+	}
+}
+
+// mapInfo is the part of maps.json that's about where things are.
+type mapInfo struct {
+	Maps map[string]struct{ Extents Extents }
+	// Regions is keyed by lowercase region ID.
+	Regions map[string]struct{ Name string }
+	// CellRegions maps "x,y" cell coordinates to region IDs.
+	CellRegions map[string]string
+}
+
+func readMapInfo(mapsJSON string) (*mapInfo, error) {
+	raw, err := os.ReadFile(mapsJSON)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", mapsJSON, err)
+	}
+	info := &mapInfo{}
+	if err := json.Unmarshal(raw, info); err != nil {
+		return nil, fmt.Errorf("parse %q: %w", mapsJSON, err)
+	}
+	return info, nil
+}
+
+// MapsJSON is where the map info is written, relative to the mod root.
+var MapsJSON = filepath.Join("00 Core", "scripts", "LivelyMap", "data", "maps.json")
+
+// mapExtents are the cells covered by all of the submaps in maps.json.
+func mapExtents(mapsJSON string) (Extents, error) {
+	info, err := readMapInfo(mapsJSON)
+	if err != nil {
+		return Extents{}, err
+	}
+	if len(info.Maps) == 0 {
+		return Extents{}, fmt.Errorf("no maps in %q", mapsJSON)
+	}
+	out := Extents{Top: math.MinInt32, Bottom: math.MaxInt32, Left: math.MaxInt32, Right: math.MinInt32}
+	for _, m := range info.Maps {
+		out.Top = max(out.Top, m.Extents.Top)
+		out.Bottom = min(out.Bottom, m.Extents.Bottom)
+		out.Left = min(out.Left, m.Extents.Left)
+		out.Right = max(out.Right, m.Extents.Right)
+	}
+	return out, nil
+}
+
+// ExploredOptions controls ExportExplored.
+type ExploredOptions struct {
+	// PixelsPerCell is the size of a cell in the masks.
+	PixelsPerCell int
+	// Paths also marks the cells in each character's path file as
+	// explored.
+	Paths bool
+}
+
+// exploreCharacter writes the explored mask for a character's newest
+// save, if they have one.
+func exploreCharacter(rootPath string, characterDir string, extents Extents, opts ExploredOptions) error {
+	saves, err := filesByAge(characterDir, ".omwsave")
+	if err != nil {
+		return fmt.Errorf("list saves: %w", err)
+	}
+	if len(saves) == 0 {
+		return nil
+	}
+	raw, err := os.ReadFile(saves[0])
+	if err != nil {
+		return fmt.Errorf("read %q: %w", saves[0], err)
+	}
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(raw))
+	if err != nil {
+		return fmt.Errorf("parse %q: %w", saves[0], err)
+	}
+	explored, err := parseGlobalMap(records)
+	if err != nil {
+		return fmt.Errorf("read global map in %q: %w", saves[0], err)
+	}
+	explored = explored.Reproject(extents, opts.PixelsPerCell)
+
+	character := filepath.Base(characterDir)
+	if opts.Paths {
+		pathFile := filepath.Join(rootPath, PathsDir, character+".json")
+		if raw, err := os.ReadFile(pathFile); err == nil {
+			data, err := Unmarshal(raw)
+			if err != nil {
+				return fmt.Errorf("bad path data in %q: %w", pathFile, err)
+			}
+			explored.AddPaths(data.Paths)
+		}
+	}
+
+	dir := filepath.Join(rootPath, ExploredDir)
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return fmt.Errorf("create %q: %w", dir, err)
+	}
+	buf := &bytes.Buffer{}
+	if err := png.Encode(buf, explored.Mask); err != nil {
+		return fmt.Errorf("encode explored mask: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, character+".png"), buf.Bytes(), 0666); err != nil {
+		return fmt.Errorf("write explored mask: %w", err)
+	}
+	meta, err := json.Marshal(explored)
+	if err != nil {
+		return fmt.Errorf("marshal explored mask info: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, character+".json"), meta, 0666); err != nil {
+		return fmt.Errorf("write explored mask info: %w", err)
+	}
+	fmt.Printf("Wrote explored mask for %q from %q.\n", character, saves[0])
+	return nil
+}
+
+// ExportExplored writes each character's explored areas from the
+// global map in their newest save, reprojected onto the cells covered
+// by LivelyMap's maps. Saves are only read.
+func ExportExplored(rootPath string, env *cfg.Environment, opts ExploredOptions) error {
+	extents, err := mapExtents(filepath.Join(rootPath, MapsJSON))
+	if err != nil {
+		return fmt.Errorf("find map extents: %w", err)
+	}
+	for _, userDir := range env.User {
+		saveDir := filepath.Join(userDir, "saves")
+		entries, err := os.ReadDir(saveDir)
+		if err != nil {
+			fmt.Printf("Failed to read saves in %q: %v\n", saveDir, err)
+			continue
+		}
+		for _, entry := range entries {
+			if !entry.IsDir() {
+				continue
+			}
+			if err := exploreCharacter(rootPath, filepath.Join(saveDir, entry.Name()), extents, opts); err != nil {
+				fmt.Printf("export explored areas for %q: %v\n", entry.Name(), err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package savefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseGlobalMap(t *testing.T) {
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
+	require.NoError(t, err)
+
+	explored, err := parseGlobalMap(records)
+	require.NoError(t, err)
+	require.Equal(t, Extents{Top: 33, Bottom: -59, Left: -139, Right: 49}, explored.Extents)
+	require.Equal(t, 18, explored.PixelsPerCell)
+	// Seyda Neen is the only place this character has been.
+	require.Equal(t, [][2]int32{{-2, -9}}, explored.Markers)
+
+	// Reproject around Seyda Neen, at 4 pixels per cell.
+	small := explored.Reproject(Extents{Top: -8, Bottom: -10, Left: -3, Right: -1}, 4)
+	require.Equal(t, 12, small.Mask.Rect.Dx())
+	require.Equal(t, 12, small.Mask.Rect.Dy())
+	explore := func(left, top int) int {
+		n := 0
+		for y := top; y < top+4; y++ {
+			for x := left; x < left+4; x++ {
+				if small.Mask.AlphaAt(x, y).A > 0 {
+					n++
+				}
+			}
+		}
+		return n
+	}
+	require.Positive(t, explore(4, 4))
+	require.Zero(t, explore(0, 0))
+	require.Zero(t, explore(8, 4))
+
+	// Cells with paths in them are explored.
+	require.Zero(t, small.Mask.AlphaAt(1, 10).A)
+	small.AddPaths([]*PathEntry{{TimeStamp: 1, Xposition: -3*cellUnits + 10, Yposition: -10*cellUnits + 10}})
+	require.Equal(t, uint8(255), small.Mask.AlphaAt(1, 10).A)
+	require.Equal(t, uint8(255), small.Mask.AlphaAt(3, 11).A)
+	require.Zero(t, small.Mask.AlphaAt(4, 11).A)
+
+	// Interior entries without a position aren't in cell 0,0.
+	origin := &ExploredMap{PixelsPerCell: 1, Mask: image.NewAlpha(image.Rect(0, 0, 1, 1))}
+	origin.AddPaths([]*PathEntry{{TimeStamp: 1, Cell: "Some House"}})
+	require.Zero(t, origin.Mask.AlphaAt(0, 0).A)
+}
+
+// globalMapRecord makes a GMAP record with bounds and a blank image.
+func globalMapRecord(t *testing.T, bounds [4]int32, width, height int) *esm.Record {
+	t.Helper()
+	bnds := &bytes.Buffer{}
+	require.NoError(t, binary.Write(bnds, binary.LittleEndian, bounds))
+	img := &bytes.Buffer{}
+	require.NoError(t, png.Encode(img, image.NewAlpha(image.Rect(0, 0, width, height))))
+	return &esm.Record{Tag: GMAP, Subrecords: []*esm.Subrecord{
+		{Tag: "BNDS", Data: bnds.Bytes()},
+		{Tag: "DATA", Data: img.Bytes()},
+	}}
+}
+
+func TestParseGlobalMapBounds(t *testing.T) {
+	// 2 cells wide and 3 tall.
+	bounds := [4]int32{0, 1, 0, 2}
+	explored, err := parseGlobalMap([]*esm.Record{globalMapRecord(t, bounds, 36, 54)})
+	require.NoError(t, err)
+	require.Equal(t, 18, explored.PixelsPerCell)
+
+	for _, size := range [][2]int{
+		{37, 54},
+		// The height is off by a row, but the rows per cell round to
+		// the same number.
+		{36, 55},
+		{36, 36},
+	} {
+		_, err := parseGlobalMap([]*esm.Record{globalMapRecord(t, bounds, size[0], size[1])})
+		require.ErrorContains(t, err, "doesn't fit bounds", "%v", size)
+	}
+}
+
+func TestExportExplored(t *testing.T) {
+	root := t.TempDir()
+	dataDir := filepath.Join(root, "00 Core", "scripts", "LivelyMap", "data")
+	require.NoError(t, os.MkdirAll(dataDir, 0777))
+	require.NoError(t, os.WriteFile(filepath.Join(dataDir, "maps.json"),
+		[]byte(`{"Maps":{"1":{"Extents":{"Top":-8,"Bottom":-9,"Left":-3,"Right":-2}},"2":{"Extents":{"Top":-9,"Bottom":-10,"Left":-2,"Right":-1}}}}`), 0666))
+	extents, err := mapExtents(filepath.Join(dataDir, "maps.json"))
+	require.NoError(t, err)
+	require.Equal(t, Extents{Top: -8, Bottom: -10, Left: -3, Right: -1}, extents)
+
+	characterDir := filepath.Join(t.TempDir(), "erintestcharacter")
+	require.NoError(t, os.MkdirAll(characterDir, 0777))
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	savePath := filepath.Join(characterDir, "1.omwsave")
+	require.NoError(t, os.WriteFile(savePath, original, 0666))
+
+	require.NoError(t, exploreCharacter(root, characterDir, extents, ExploredOptions{PixelsPerCell: 8}))
+	in, err := os.Open(filepath.Join(root, ExploredDir, "erintestcharacter.png"))
+	require.NoError(t, err)
+	defer in.Close()
+	img, err := png.Decode(in)
+	require.NoError(t, err)
+	require.Equal(t, 24, img.Bounds().Dx())
+	_, _, _, a := img.At(12, 12).RGBA()
+	require.NotZero(t, a)
+
+	// The save is only read.
+	current, err := os.ReadFile(savePath)
+	require.NoError(t, err)
+	require.Equal(t, original, current)
+}
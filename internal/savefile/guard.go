@@ -0,0 +1,102 @@
+package savefile
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultGrace is how long after a save was last written before it's
+// safe to change it.
+const DefaultGrace = 30 * time.Second
+
+// procDir is where running processes are listed on Linux.
+var procDir = "/proc"
+
+// pollInterval is how often a busy save is checked while waiting for
+// it.
+var pollInterval = time.Second
+
+// openMWNames are the process names of the game. The launcher doesn't
+// write saves, so it's not here.
+var openMWNames = []string{"openmw", "openmw.exe"}
+
+// openMWRunning checks the processes listed in dir for OpenMW.
+// It returns the PID of the first one found, or 0.
+func openMWRunning(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return 0, fmt.Errorf("read dir %q: %w", dir, err)
+	}
+	for _, entry := range entries {
+		pid, err := strconv.Atoi(entry.Name())
+		if err != nil || !entry.IsDir() {
+			continue
+		}
+		// Processes can exit while we look at them.
+		comm, err := os.ReadFile(filepath.Join(dir, entry.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSpace(string(comm))
+		for _, openMW := range openMWNames {
+			if strings.EqualFold(name, openMW) {
+				return pid, nil
+			}
+		}
+	}
+	return 0, nil
+}
+
+// gameBusy is why saves can't be changed right now, or empty if they
+// can. Only Linux is checked.
+func gameBusy() (string, error) {
+	if runtime.GOOS != "linux" {
+		return "", nil
+	}
+	pid, err := openMWRunning(procDir)
+	if err != nil {
+		return "", fmt.Errorf("look for a running OpenMW: %w", err)
+	}
+	if pid != 0 {
+		return fmt.Sprintf("OpenMW is running (pid %d)", pid), nil
+	}
+	return "", nil
+}
+
+// saveBusy is why savePath can't be changed at now, or empty if it
+// can. A save written less than grace ago might still be being written.
+func saveBusy(savePath string, grace time.Duration, now time.Time) (string, error) {
+	info, err := os.Stat(savePath)
+	if err != nil {
+		return "", fmt.Errorf("stat %q: %w", savePath, err)
+	}
+	if age := now.Sub(info.ModTime()); age < grace {
+		return fmt.Sprintf("%q was written %s ago, less than the %s grace window", savePath, age.Round(time.Second), grace), nil
+	}
+	return "", nil
+}
+
+// waitFor checks busy until it's empty or wait has passed. It returns
+// the last reason busy gave, which is empty if it's safe to go on.
+func waitFor(wait time.Duration, busy func() (string, error)) (string, error) {
+	deadline := time.Now().Add(wait)
+	for announced := false; ; announced = true {
+		reason, err := busy()
+		if err != nil || len(reason) == 0 {
+			return reason, err
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return reason, nil
+		}
+		if !announced {
+			fmt.Printf("Waiting up to %s because %s.\n", wait, reason)
+		}
+		time.Sleep(min(pollInterval, remaining))
+	}
+}
@@ -0,0 +1,83 @@
+package savefile
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestOpenMWRunning(t *testing.T) {
+	dir := t.TempDir()
+	process := func(pid string, comm string) {
+		require.NoError(t, os.MkdirAll(filepath.Join(dir, pid), 0777))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, pid, "comm"), []byte(comm+"\n"), 0666))
+	}
+	process("1", "init")
+	process("20", "openmw-launcher")
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, "self"), 0777))
+
+	pid, err := openMWRunning(dir)
+	require.NoError(t, err)
+	require.Zero(t, pid)
+
+	process("300", "openmw")
+	pid, err = openMWRunning(dir)
+	require.NoError(t, err)
+	require.Equal(t, 300, pid)
+}
+
+func TestSaveBusy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "test.omwsave")
+	require.NoError(t, os.WriteFile(path, nil, 0666))
+	written := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	require.NoError(t, os.Chtimes(path, written, written))
+
+	reason, err := saveBusy(path, time.Minute, written.Add(10*time.Second))
+	require.NoError(t, err)
+	require.Contains(t, reason, "10s ago")
+
+	reason, err = saveBusy(path, time.Minute, written.Add(time.Minute))
+	require.NoError(t, err)
+	require.Empty(t, reason)
+}
+
+func TestWaitFor(t *testing.T) {
+	defer func(old time.Duration) { pollInterval = old }(pollInterval)
+	pollInterval = time.Millisecond
+
+	checks := 0
+	reason, err := waitFor(time.Minute, func() (string, error) {
+		checks++
+		if checks < 3 {
+			return "busy", nil
+		}
+		return "", nil
+	})
+	require.NoError(t, err)
+	require.Empty(t, reason)
+	require.Equal(t, 3, checks)
+
+	// Without a wait, the first reason is returned.
+	reason, err = waitFor(0, func() (string, error) { return "busy", nil })
+	require.NoError(t, err)
+	require.Equal(t, "busy", reason)
+}
+
+func TestExtractCharacterSkipsNewSave(t *testing.T) {
+	characterDir := filepath.Join(t.TempDir(), "erintestcharacter")
+	require.NoError(t, os.MkdirAll(characterDir, 0777))
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	savePath := filepath.Join(characterDir, "1.omwsave")
+	require.NoError(t, os.WriteFile(savePath, original, 0666))
+
+	report, err := extractCharacter(t.TempDir(), characterDir, nil, ExtractOptions{Grace: time.Hour})
+	require.NoError(t, err)
+	require.Nil(t, report)
+	current, err := os.ReadFile(savePath)
+	require.NoError(t, err)
+	require.Equal(t, original, current)
+}
@@ -0,0 +1,148 @@
+package savefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/ernmw/omwpacker/esm"
+)
+
+// SAVE is the record at the start of a save that describes it.
+const SAVE = esm.RecordTag("SAVE")
+
+// months are the names of the months of the year, from Morning Star.
+var months = []string{
+	"Morning Star", "Sun's Dawn", "First Seed", "Rain's Hand",
+	"Second Seed", "Midyear", "Sun's Height", "Last Seed",
+	"Hearthfire", "Frostfall", "Sun's Dusk", "Evening Star",
+}
+
+// SaveHeader is what a save says about itself, from its SAVE record.
+type SaveHeader struct {
+	Name  string `json:"name"`
+	Level int32  `json:"level,omitempty"`
+	Class string `json:"class,omitempty"`
+	Cell  string `json:"cell,omitempty"`
+	// Hour, Day, Month, and Year are the in-game date. Month counts
+	// from 0.
+	Hour  float32 `json:"hour"`
+	Day   int32   `json:"day"`
+	Month int32   `json:"month"`
+	Year  int32   `json:"year"`
+	// Played is the real time spent playing, in seconds.
+	Played      float64 `json:"played,omitempty"`
+	Description string  `json:"description,omitempty"`
+	// Content is the load order the save was made with.
+	Content []string `json:"content,omitempty"`
+}
+
+// Date is the in-game date, like "16 Last Seed, 3E 427".
+func (h *SaveHeader) Date() string {
+	month := fmt.Sprintf("month %d", h.Month)
+	if h.Month >= 0 && int(h.Month) < len(months) {
+		month = months[h.Month]
+	}
+	return fmt.Sprintf("%d %s, 3E %d", h.Day, month, h.Year)
+}
+
+// cString is a subrecord's string, without any trailing NULs.
+func cString(data []byte) string {
+	return string(bytes.TrimRight(data, "\x00"))
+}
+
+// parseHeader reads the SAVE record, which OpenMW writes in
+// components/esm3/savedgame.cpp.
+func parseHeader(records []*esm.Record) (*SaveHeader, error) {
+	idx := slices.IndexFunc(records, func(rec *esm.Record) bool {
+		return rec.Tag == SAVE
+	})
+	if idx < 0 {
+		return nil, fmt.Errorf("didn't find the SAVE record")
+	}
+	h := &SaveHeader{}
+	for _, sub := range records[idx].Subrecords {
+		var err error
+		switch sub.Tag {
+		case "PLNA":
+			h.Name = cString(sub.Data)
+		case "PLLE":
+			err = binary.Read(bytes.NewReader(sub.Data), binary.LittleEndian, &h.Level)
+		case "PLCL":
+			// This is a RefId, which starts with its type.
+			if len(sub.Data) > 0 {
+				h.Class = cString(sub.Data[1:])
+			}
+		case "PLCN":
+			// Custom classes have a name too.
+			h.Class = cString(sub.Data)
+		case "PLCE":
+			h.Cell = cString(sub.Data)
+		case "TSTM":
+			if len(sub.Data) < 16 {
+				err = fmt.Errorf("expected 16 bytes, got %d", len(sub.Data))
+				break
+			}
+			h.Hour = math.Float32frombits(binary.LittleEndian.Uint32(sub.Data[0:]))
+			h.Day = int32(binary.LittleEndian.Uint32(sub.Data[4:]))
+			h.Month = int32(binary.LittleEndian.Uint32(sub.Data[8:]))
+			h.Year = int32(binary.LittleEndian.Uint32(sub.Data[12:]))
+		case "TIME":
+			err = binary.Read(bytes.NewReader(sub.Data), binary.LittleEndian, &h.Played)
+		case "DESC":
+			h.Description = cString(sub.Data)
+		case "DEPE":
+			h.Content = append(h.Content, cString(sub.Data))
+		}
+		if err != nil {
+			return nil, fmt.Errorf("parse %s subrecord: %w", sub.Tag, err)
+		}
+	}
+	return h, nil
+}
+
+// ContentMismatch describes how the content files the save was made
+// with differ from loadOrder, or is empty if they're the same. Only
+// files with records are compared, since scripts don't change the map.
+func (h *SaveHeader) ContentMismatch(loadOrder []string) string {
+	hasRecords := func(files []string) []string {
+		out := []string{}
+		for _, file := range files {
+			if !strings.EqualFold(filepath.Ext(file), ".omwscripts") {
+				out = append(out, strings.ToLower(filepath.Base(file)))
+			}
+		}
+		return out
+	}
+	saved, current := hasRecords(h.Content), hasRecords(loadOrder)
+	if slices.Equal(saved, current) {
+		return ""
+	}
+	missing := []string{}
+	for _, file := range saved {
+		if !slices.Contains(current, file) {
+			missing = append(missing, file)
+		}
+	}
+	added := []string{}
+	for _, file := range current {
+		if !slices.Contains(saved, file) {
+			added = append(added, file)
+		}
+	}
+	problems := []string{}
+	if len(missing) > 0 {
+		problems = append(problems, fmt.Sprintf("not loaded now: %s", strings.Join(missing, ", ")))
+	}
+	if len(added) > 0 {
+		problems = append(problems, fmt.Sprintf("not in the save: %s", strings.Join(added, ", ")))
+	}
+	if len(problems) == 0 {
+		problems = append(problems, "the load order is different")
+	}
+	return strings.Join(problems, "; ")
+}
@@ -0,0 +1,42 @@
+package savefile
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseHeader(t *testing.T) {
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
+	require.NoError(t, err)
+
+	h, err := parseHeader(records)
+	require.NoError(t, err)
+	require.Equal(t, "erintestcharacter", h.Name)
+	require.Equal(t, int32(1), h.Level)
+	require.Equal(t, "Bard", h.Class)
+	require.Equal(t, "Seyda Neen", h.Cell)
+	require.Equal(t, "16 Last Seed, 3E 427", h.Date())
+	require.InDelta(t, 10.06, h.Hour, 0.01)
+	require.Greater(t, h.Played, 0.0)
+	require.Equal(t, "maptestfile", h.Description)
+	require.Equal(t, "builtin.omwscripts", h.Content[0])
+	require.Contains(t, h.Content, "LivelyMap.omwaddon")
+}
+
+func TestContentMismatch(t *testing.T) {
+	h := &SaveHeader{Content: []string{"builtin.omwscripts", "Morrowind.esm", "Tribunal.esm", "LivelyMap.omwaddon"}}
+
+	// Scripts, folders, and case don't matter.
+	require.Empty(t, h.ContentMismatch([]string{"/data/morrowind.esm", "/data/Tribunal.esm", "/mods/LivelyMap.omwaddon", "/mods/other.omwscripts"}))
+
+	require.Equal(t, "not loaded now: tribunal.esm; not in the save: bloodmoon.esm",
+		h.ContentMismatch([]string{"Morrowind.esm", "Bloodmoon.esm", "LivelyMap.omwaddon"}))
+	require.Equal(t, "the load order is different",
+		h.ContentMismatch([]string{"Morrowind.esm", "LivelyMap.omwaddon", "Tribunal.esm"}))
+}
@@ -0,0 +1,199 @@
+package savefile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/ernmw/omwpacker/esm/record/lua"
+)
+
+// OpenMW's Lua serialization format, from components/lua/serialization.cpp.
+const (
+	luaFormatVersion = 0x00
+	luaLongString    = 0x01
+	luaTableStart    = 0x03
+	luaTableEnd      = 0x04
+	luaShortString   = 0x20
+	luaShortMax      = 0x1f
+)
+
+// appendLuaString serializes s the way OpenMW does.
+func appendLuaString(out []byte, s []byte) []byte {
+	if len(s) <= luaShortMax {
+		out = append(out, luaShortString|byte(len(s)))
+	} else {
+		out = append(out, luaLongString)
+		out = binary.LittleEndian.AppendUint32(out, uint32(len(s)))
+	}
+	return append(out, s...)
+}
+
+// scriptData is the LUAD payload for the LivelyMap player script,
+// which is the table its onSave returns: { json = <wrapped JSON> }.
+func scriptData(raw []byte) []byte {
+	out := []byte{luaFormatVersion, luaTableStart}
+	out = appendLuaString(out, []byte("json"))
+	out = appendLuaString(out, slices.Concat([]byte(magic_prefix), raw, []byte(magic_suffix)))
+	return append(out, luaTableEnd)
+}
+
+// Trim keeps the entries of data from game time from to game time to,
+// inclusive. A to of 0 has no end.
+func Trim(data *SaveData, from uint64, to uint64) *SaveData {
+	out := &SaveData{Player: data.Player, Extra: data.Extra}
+	for _, entry := range data.Paths {
+		if entry.TimeStamp >= from && (to == 0 || entry.TimeStamp <= to) {
+			out.Paths = append(out.Paths, entry)
+		}
+	}
+	return out
+}
+
+// injectRecord puts payload into the LUAD of the LivelyMap player
+// script. If the save doesn't have the script yet, it's added after
+// the other Lua scripts of the player.
+func injectRecord(records []*esm.Record, payload []byte) error {
+	for _, rec := range records {
+		if rec.Tag != PLAY {
+			continue
+		}
+		luad := &esm.Subrecord{Tag: lua.LUAD, Data: payload}
+		for i, sub := range rec.Subrecords {
+			if sub.Tag != lua.LUAS {
+				continue
+			}
+			lf := lua.LUASField{}
+			if err := lf.Unmarshal(sub); err != nil {
+				return fmt.Errorf("parse LUAS subrecord: %w", err)
+			}
+			if lf.Value != playerScript {
+				continue
+			}
+			if i+1 < len(rec.Subrecords) && rec.Subrecords[i+1].Tag == lua.LUAD {
+				rec.Subrecords[i+1] = luad
+			} else {
+				rec.Subrecords = slices.Insert(rec.Subrecords, i+1, luad)
+			}
+			return nil
+		}
+
+		// Scripts are a LUAS, then its optional LUAD and timers.
+		first := slices.IndexFunc(rec.Subrecords, func(sub *esm.Subrecord) bool {
+			return sub.Tag == lua.LUAS
+		})
+		if first < 0 {
+			return fmt.Errorf("PLAY record has no Lua scripts")
+		}
+		end := first
+		for end < len(rec.Subrecords) && slices.Contains([]esm.SubrecordTag{lua.LUAS, lua.LUAD, "LUAT"}, rec.Subrecords[end].Tag) {
+			end++
+		}
+		luas, err := (&lua.LUASField{Value: playerScript}).Marshal()
+		if err != nil {
+			return fmt.Errorf("marshal LUAS subrecord: %w", err)
+		}
+		rec.Subrecords = slices.Insert(rec.Subrecords, end, luas, luad)
+		return nil
+	}
+	return fmt.Errorf("didn't find the PLAY record")
+}
+
+// InjectOptions controls InjectData.
+type InjectOptions struct {
+	// Backups is the number of backups kept of the save.
+	Backups int
+	// Grace is how long after the save was written before it can be
+	// changed.
+	Grace time.Duration
+	// Wait is how long to wait for OpenMW to close, or for the save's
+	// grace window to pass, before giving up.
+	Wait time.Duration
+}
+
+// InjectData writes data back into a save, so it has the path history
+// it would have had if it was never extracted. If the save already
+// has LivelyMap data, data is merged with it. data has to be for the
+// save's character. The save is backed up first, and the rewritten
+// save is checked before it replaces the original. It returns the data
+// that's now in the save.
+//
+// Like extraction, it won't touch the save while OpenMW is running or
+// the save was just written.
+func InjectData(savePath string, data *SaveData, opts InjectOptions) (*SaveData, error) {
+	for _, busy := range []func() (string, error){
+		gameBusy,
+		func() (string, error) { return saveBusy(savePath, opts.Grace, time.Now()) },
+	} {
+		reason, err := waitFor(opts.Wait, busy)
+		if err != nil {
+			return nil, err
+		}
+		if len(reason) > 0 {
+			return nil, fmt.Errorf("not injecting paths into %q because %s", savePath, reason)
+		}
+	}
+
+	original, err := os.ReadFile(savePath)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", savePath, err)
+	}
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
+	if err != nil {
+		return nil, fmt.Errorf("parse %q: %w", savePath, err)
+	}
+	header, err := parseHeader(records)
+	if err != nil {
+		return nil, fmt.Errorf("read header of %q: %w", savePath, err)
+	}
+	if !strings.EqualFold(header.Name, data.Player) {
+		return nil, fmt.Errorf("path data is for %q, but %q is %q's save", data.Player, savePath, header.Name)
+	}
+
+	// Branches and headers only live in path files.
+	data = &SaveData{Player: data.Player, Paths: data.Paths, Extra: data.Extra}
+	if existing, err := readSave(savePath); err == nil {
+		data, err = Merge(data, existing.data)
+		if err != nil {
+			return nil, fmt.Errorf("merge with the data in %q: %w", savePath, err)
+		}
+	}
+	if err := Validate(data); err != nil {
+		return nil, fmt.Errorf("validate path data: %w", err)
+	}
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("marshal path data: %w", err)
+	}
+	if err := injectRecord(records, scriptData(raw)); err != nil {
+		return nil, fmt.Errorf("inject data into %q: %w", savePath, err)
+	}
+
+	if _, err := backupSave(savePath, original, time.Now(), opts.Backups); err != nil {
+		return nil, err
+	}
+	if err := replaceFile(savePath, func(w io.Writer) error {
+		return esm.WriteRecords(w, slices.Values(records))
+	}, func(written []byte, rewritten []*esm.Record) error {
+		// Taking the data back out has to leave the original save,
+		// minus any data it had.
+		found, err := extractRecord(rewritten)
+		if err != nil {
+			return fmt.Errorf("extract injected data: %w", err)
+		}
+		if !bytes.Equal(found, raw) {
+			return fmt.Errorf("injected data changed")
+		}
+		return verifyRewrite(original, written)
+	}); err != nil {
+		return nil, fmt.Errorf("rewrite save file %q: %w", savePath, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,90 @@
+package savefile
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/ernmw/omwpacker/esm"
+	"github.com/stretchr/testify/require"
+)
+
+func TestScriptData(t *testing.T) {
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
+	require.NoError(t, err)
+	var luad []byte
+	for _, rec := range records {
+		i, err := livelyMapScript(rec)
+		require.NoError(t, err)
+		if i >= 0 {
+			luad = rec.Subrecords[i+1].Data
+		}
+	}
+	raw, err := extractRecord(records)
+	require.NoError(t, err)
+
+	// This is byte for byte what OpenMW writes.
+	require.Equal(t, luad, scriptData(raw))
+}
+
+func TestInjectData(t *testing.T) {
+	path, _ := copySave(t)
+	data, err := ExtractData(path, 5)
+	require.NoError(t, err)
+	require.Greater(t, len(data.Paths), 2)
+
+	// Put back only the first half.
+	from, to := data.Paths[0].TimeStamp, data.Paths[len(data.Paths)/2].TimeStamp
+	trimmed := Trim(data, from, to)
+	require.Less(t, len(trimmed.Paths), len(data.Paths))
+	injected, err := InjectData(path, trimmed, InjectOptions{Backups: 5})
+	require.NoError(t, err)
+	require.Equal(t, trimmed.Paths, injected.Paths)
+
+	save, err := readSave(path)
+	require.NoError(t, err)
+	require.Equal(t, trimmed.Paths, save.data.Paths)
+	backups, err := Backups(path)
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+
+	// Injecting into a save that has data merges with it, and the
+	// save's data wins where they overlap.
+	injected, err = InjectData(path, data, InjectOptions{Backups: 5})
+	require.NoError(t, err)
+	require.Equal(t, trimmed.Paths, injected.Paths)
+	// Later entries are added after the save's.
+	injected, err = InjectData(path, Trim(data, to+1, 0), InjectOptions{Backups: 5})
+	require.NoError(t, err)
+	require.Equal(t, times(data.Paths), times(injected.Paths))
+
+	// Extraction takes it all back out.
+	extracted, err := ExtractData(path, 5)
+	require.NoError(t, err)
+	require.Equal(t, injected.Paths, extracted.Paths)
+}
+
+func TestInjectDataRefuses(t *testing.T) {
+	path, original := copySave(t)
+	data, err := ExtractData(path, 5)
+	require.NoError(t, err)
+	extracted, err := os.ReadFile(path)
+	require.NoError(t, err)
+
+	// The save was just written.
+	_, err = InjectData(path, data, InjectOptions{Backups: 5, Grace: time.Hour})
+	require.ErrorContains(t, err, "grace window")
+
+	// The save has no data of its own to catch this.
+	other := &SaveData{Player: "someone else", Paths: data.Paths}
+	_, err = InjectData(path, other, InjectOptions{Backups: 5})
+	require.ErrorContains(t, err, "someone else")
+
+	after, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, extracted, after)
+	require.NotEqual(t, original, after)
+}
@@ -0,0 +1,208 @@
+package savefile
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+
+	"github.com/erinpentecost/LivelyMap/internal/geojson"
+)
+
+const (
+	// MetersPerUnit is the size of a world unit. Morrowind's units are
+	// 0.5625 inches, so a cell is about 117 meters wide.
+	MetersPerUnit = 0.0142875
+	// metersPerDegree is the length of a degree along the equator of
+	// the WGS 84 ellipsoid.
+	metersPerDegree = 111319.49079327357
+)
+
+// Project turns an entry's world position into longitude, latitude,
+// and elevation for GIS tools.
+//
+// It's an equirectangular projection around 0°, 0°: longitude is
+// x * MetersPerUnit / metersPerDegree, latitude is the same for y, and
+// elevation is z * MetersPerUnit, in meters. That close to the
+// equator, distances measured in GIS tools are within a fraction of a
+// percent of the distances in game.
+func Project(entry *PathEntry) [3]float64 {
+	return [3]float64{
+		entry.Xposition * MetersPerUnit / metersPerDegree,
+		entry.Yposition * MetersPerUnit / metersPerDegree,
+		entry.Zposition * MetersPerUnit,
+	}
+}
+
+// monthDays are the lengths of the months. There are no leap years.
+var monthDays = []uint64{31, 28, 31, 30, 31, 30, 31, 31, 30, 31, 30, 31}
+
+// GameTime formats a path entry's time as an ISO 8601 timestamp in
+// the Tamriel calendar, with Morning Star as month 1.
+//
+// Entry times are game seconds from midnight on the day before a new
+// game starts, which is 15 Last Seed, 3E 427 in Morrowind.
+func GameTime(t uint64) string {
+	year, month, day := uint64(427), 7, uint64(15)
+	days := t / 86400
+	for days > 0 {
+		if left := monthDays[month] - day; days > left {
+			days -= left + 1
+			day = 1
+			month++
+			if month == len(monthDays) {
+				month = 0
+				year++
+			}
+			continue
+		}
+		day += days
+		days = 0
+	}
+	seconds := t % 86400
+	return fmt.Sprintf("%04d-%02d-%02dT%02d:%02d:%02dZ", year, month+1, day, seconds/3600, seconds/60%60, seconds%60)
+}
+
+// Segments splits paths wherever the player teleported or went into an
+// interior. Interior entries aren't in any segment, and are returned
+// on their own. Interior entries without a position are put where the
+// player last was outside, or left out if there's nowhere.
+func Segments(paths []*PathEntry) (segments [][]*PathEntry, interiors []*PathEntry) {
+	var current []*PathEntry
+	end := func() {
+		if len(current) > 0 {
+			segments = append(segments, current)
+		}
+		current = nil
+	}
+	var outside *PathEntry
+	for i, entry := range paths {
+		if len(entry.Cell) > 0 {
+			end()
+			if !hasPosition(entry) {
+				if outside == nil {
+					continue
+				}
+				located := *entry
+				located.Xposition, located.Yposition, located.Zposition = outside.Xposition, outside.Yposition, outside.Zposition
+				entry = &located
+			}
+			interiors = append(interiors, entry)
+			continue
+		}
+		outside = entry
+		if i > 0 && teleported(paths[i-1], entry) {
+			end()
+		}
+		current = append(current, entry)
+	}
+	end()
+	return segments, interiors
+}
+
+// JourneysGeoJSON makes a LineString for each segment of a character's
+// paths, and a Point for each interior visit. Coordinates are
+// longitude, latitude, and elevation from Project, or world units if
+// worldUnits is set. Each LineString has the game time of each of its
+// points in "times", and as ISO 8601 in "coordTimes".
+func JourneysGeoJSON(data *SaveData, worldUnits bool) *geojson.FeatureCollection {
+	position := Project
+	if worldUnits {
+		position = func(entry *PathEntry) [3]float64 {
+			return [3]float64{entry.Xposition, entry.Yposition, entry.Zposition}
+		}
+	}
+	out := geojson.NewFeatureCollection()
+	segments, interiors := Segments(data.Paths)
+	for i, segment := range segments {
+		points := make([][3]float64, 0, len(segment))
+		times := make([]uint64, 0, len(segment))
+		coordTimes := make([]string, 0, len(segment))
+		for _, entry := range segment {
+			points = append(points, position(entry))
+			times = append(times, entry.TimeStamp)
+			coordTimes = append(coordTimes, GameTime(entry.TimeStamp))
+		}
+		properties := map[string]any{
+			"character":  data.Player,
+			"segment":    i,
+			"start":      coordTimes[0],
+			"end":        coordTimes[len(coordTimes)-1],
+			"times":      times,
+			"coordTimes": coordTimes,
+		}
+		geometry := geojson.LineStringZ(points)
+		if len(points) == 1 {
+			geometry = geojson.PointZ(points[0][0], points[0][1], points[0][2])
+		}
+		out.Add(geojson.NewFeature(geometry, properties))
+	}
+	for _, entry := range interiors {
+		p := position(entry)
+		out.Add(geojson.NewFeature(geojson.PointZ(p[0], p[1], p[2]), map[string]any{
+			"character": data.Player,
+			"cell":      entry.Cell,
+			"time":      GameTime(entry.TimeStamp),
+			"t":         entry.TimeStamp,
+		}))
+	}
+	return out
+}
+
+type gpxPoint struct {
+	Lat  float64 `xml:"lat,attr"`
+	Lon  float64 `xml:"lon,attr"`
+	Ele  float64 `xml:"ele"`
+	Time string  `xml:"time"`
+	Name string  `xml:"name,omitempty"`
+}
+
+func newGPXPoint(entry *PathEntry) gpxPoint {
+	p := Project(entry)
+	return gpxPoint{Lon: p[0], Lat: p[1], Ele: p[2], Time: GameTime(entry.TimeStamp)}
+}
+
+type gpxSegment struct {
+	Points []gpxPoint `xml:"trkpt"`
+}
+
+type gpx struct {
+	XMLName   xml.Name   `xml:"gpx"`
+	Version   string     `xml:"version,attr"`
+	Creator   string     `xml:"creator,attr"`
+	Namespace string     `xml:"xmlns,attr"`
+	Waypoints []gpxPoint `xml:"wpt"`
+	Track     struct {
+		Name     string       `xml:"name"`
+		Segments []gpxSegment `xml:"trkseg"`
+	} `xml:"trk"`
+}
+
+// WriteGPX writes a character's paths as a GPX 1.1 track, with a track
+// segment for each of Segments, and a waypoint for each interior
+// visit. Positions come from Project.
+func WriteGPX(w io.Writer, data *SaveData) error {
+	doc := gpx{Version: "1.1", Creator: "LivelyMap", Namespace: "http://www.topografix.com/GPX/1/1"}
+	doc.Track.Name = data.Player
+	segments, interiors := Segments(data.Paths)
+	for _, entry := range interiors {
+		p := newGPXPoint(entry)
+		p.Name = entry.Cell
+		doc.Waypoints = append(doc.Waypoints, p)
+	}
+	for _, segment := range segments {
+		s := gpxSegment{}
+		for _, entry := range segment {
+			s.Points = append(s.Points, newGPXPoint(entry))
+		}
+		doc.Track.Segments = append(doc.Track.Segments, s)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return fmt.Errorf("encode gpx: %w", err)
+	}
+	return nil
+}
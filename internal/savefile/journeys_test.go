@@ -0,0 +1,126 @@
+package savefile
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestGameTime(t *testing.T) {
+	// A new game starts at 9 in the morning on day 1.
+	require.Equal(t, "0427-08-16T09:00:00Z", GameTime(86400+9*3600))
+	require.Equal(t, "0427-08-15T00:00:00Z", GameTime(0))
+	// 17 days later is the first of Hearthfire.
+	require.Equal(t, "0427-09-01T00:00:30Z", GameTime(17*86400+30))
+	// There are no leap years.
+	require.Equal(t, "0428-08-15T00:00:00Z", GameTime(365*86400))
+}
+
+func TestSegments(t *testing.T) {
+	paths := []*PathEntry{
+		at(100, 100, 100),
+		at(200, 4100, 100),
+		{TimeStamp: 300, Xposition: 4100, Yposition: 100, Cell: "Some House"},
+		at(400, 4100, 100),
+		// A teleport.
+		at(500, 10*cellUnits, 100),
+		at(600, 10*cellUnits+1000, 100),
+	}
+	segments, interiors := Segments(paths)
+	require.Equal(t, [][]*PathEntry{paths[0:2], paths[3:4], paths[4:6]}, segments)
+	require.Equal(t, []*PathEntry{paths[2]}, interiors)
+}
+
+func TestSegmentsSave(t *testing.T) {
+	save, err := readSave(saveFile)
+	require.NoError(t, err)
+	segments, interiors := Segments(save.data.Paths)
+	require.Len(t, segments, 3)
+	require.Len(t, interiors, 2)
+	require.Equal(t, "seyda neen, census and excise office", interiors[0].Cell)
+	// The save is from before interior entries had a position, so
+	// they're put where the player went in.
+	require.Equal(t, save.data.Paths[0].Xposition, interiors[0].Xposition)
+	require.Equal(t, save.data.Paths[0].Yposition, interiors[0].Yposition)
+	require.Zero(t, save.data.Paths[1].Xposition)
+}
+
+func TestJourneysGeoJSON(t *testing.T) {
+	data := &SaveData{Player: "p", Paths: []*PathEntry{
+		at(100, 0, 0),
+		{TimeStamp: 200, Xposition: cellUnits, Yposition: -cellUnits, Zposition: 1000},
+		{TimeStamp: 300, Cell: "Some House"},
+	}}
+	raw, err := json.Marshal(JourneysGeoJSON(data, false))
+	require.NoError(t, err)
+	var parsed struct {
+		Features []struct {
+			Geometry struct {
+				Type        string
+				Coordinates json.RawMessage
+			}
+			Properties map[string]any
+		}
+	}
+	require.NoError(t, json.Unmarshal(raw, &parsed))
+	require.Len(t, parsed.Features, 2)
+
+	line := parsed.Features[0]
+	require.Equal(t, "LineString", line.Geometry.Type)
+	var points [][3]float64
+	require.NoError(t, json.Unmarshal(line.Geometry.Coordinates, &points))
+	require.Len(t, points, 2)
+	// A cell is about 117 meters, or about a thousandth of a degree.
+	require.InDelta(t, 0.00105, points[1][0], 0.00001)
+	require.InDelta(t, -0.00105, points[1][1], 0.00001)
+	require.InDelta(t, 14.2875, points[1][2], 0.0001)
+	require.Equal(t, []any{GameTime(100), GameTime(200)}, line.Properties["coordTimes"])
+
+	interior := parsed.Features[1]
+	require.Equal(t, "Point", interior.Geometry.Type)
+	require.Equal(t, "Some House", interior.Properties["cell"])
+
+	raw, err = json.Marshal(JourneysGeoJSON(data, true))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(raw, &parsed))
+	require.NoError(t, json.Unmarshal(parsed.Features[0].Geometry.Coordinates, &points))
+	require.Equal(t, [3]float64{cellUnits, -cellUnits, 1000}, points[1])
+}
+
+func TestWriteGPX(t *testing.T) {
+	data := &SaveData{Player: "p", Paths: []*PathEntry{
+		at(100, 0, 0),
+		at(200, 1000, 0),
+		{TimeStamp: 300, Cell: "Some House"},
+		at(400, 1000, 0),
+	}}
+	buf := &bytes.Buffer{}
+	require.NoError(t, WriteGPX(buf, data))
+
+	var parsed struct {
+		Waypoints []struct {
+			Name string `xml:"name"`
+			Time string `xml:"time"`
+		} `xml:"wpt"`
+		Track struct {
+			Name     string `xml:"name"`
+			Segments []struct {
+				Points []struct {
+					Lon  float64 `xml:"lon,attr"`
+					Time string  `xml:"time"`
+				} `xml:"trkpt"`
+			} `xml:"trkseg"`
+		} `xml:"trk"`
+	}
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &parsed))
+	require.Len(t, parsed.Waypoints, 1)
+	require.Equal(t, "Some House", parsed.Waypoints[0].Name)
+	require.Equal(t, "p", parsed.Track.Name)
+	require.Len(t, parsed.Track.Segments, 2)
+	require.Len(t, parsed.Track.Segments[0].Points, 2)
+	require.Equal(t, GameTime(200), parsed.Track.Segments[0].Points[1].Time)
+	require.Greater(t, parsed.Track.Segments[0].Points[1].Lon, 0.0)
+}
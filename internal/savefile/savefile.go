@@ -3,13 +3,15 @@ package savefile
 import (
 	"bufio"
 	"bytes"
+	"encoding/binary"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
-	"path/filepath"
 	"slices"
 	"strings"
+	"time"
 
 	"github.com/ernmw/omwpacker/esm"
 	"github.com/ernmw/omwpacker/esm/record/lua"
@@ -19,8 +21,14 @@ const magic_prefix = "!!LivelyMap!!STARTOFENTRY!!"
 const magic_suffix = "!!LivelyMap!!ENDOFENTRY!!"
 
 type SaveData struct {
-	Player string           `json:"id"`
-	Paths  []*PathEntry     `json:"paths"`
+	Player string       `json:"id"`
+	Paths  []*PathEntry `json:"paths"`
+	// Branches are archived timelines from older saves that split off
+	// from Paths when the player reloaded. Only path files have them.
+	Branches []*Branch `json:"branches,omitempty"`
+	// Header describes the newest save the paths were extracted from.
+	// Only path files have it.
+	Header *SaveHeader      `json:"header,omitempty"`
 	Extra  *json.RawMessage `json:"extra,omitempty"`
 }
 
@@ -33,6 +41,19 @@ type PathEntry struct {
 	Yposition float64 `json:"y,omitempty"`
 	// Zposition is an exterior world Z position.
 	Zposition float64 `json:"z,omitempty"`
+	// Cell is the ID of the interior cell the player went into, if
+	// they went into one. The position is then the exterior position
+	// they went in from. Older versions of the player script didn't
+	// write a position for these.
+	Cell string `json:"c,omitempty"`
+	// Teleport is set on the first entry after the player teleported
+	// or traveled. Extraction sets it; the player script doesn't.
+	Teleport bool `json:"j,omitempty"`
+}
+
+// hasPosition is false for interior entries that only have a cell.
+func hasPosition(entry *PathEntry) bool {
+	return entry.Xposition != 0 || entry.Yposition != 0 || entry.Zposition != 0
 }
 
 func Validate(a *SaveData) error {
@@ -99,29 +120,47 @@ func Merge(a *SaveData, b *SaveData) (*SaveData, error) {
 	return &SaveData{Player: a.Player, Paths: merged, Extra: b.Extra}, nil
 }
 
-func ExtractData(savePath string) (*SaveData, error) {
-	// open file and back it up
-	src, err := os.OpenFile(savePath, os.O_RDWR, 0666)
-	if err != nil {
-		return nil, fmt.Errorf("read %q: %w", savePath, err)
-	}
-	defer src.Close()
-	backupPath := strings.TrimSuffix(savePath, filepath.Ext(savePath)) + ".bak"
-	backup, err := os.Create(backupPath)
+// ExtractData pulls the LivelyMap data out of a save, and rewrites the
+// save without it. The save is backed up first, keeping at most
+// backups backups of it. The rewritten save is checked before it
+// replaces the original.
+func ExtractData(savePath string, backups int) (*SaveData, error) {
+	save, err := readSave(savePath)
 	if err != nil {
-		return nil, fmt.Errorf("create %q: %w", backupPath, err)
+		return nil, err
 	}
-	if _, err := io.Copy(backup, src); err != nil {
-		return nil, fmt.Errorf("back up %q to %q: %w", savePath, backupPath, err)
+	if err := save.commit(backups); err != nil {
+		return nil, err
 	}
-	// parse file
-	if _, err := src.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("seek to start of %q: %w", savePath, err)
+	return save.data, nil
+}
+
+// extractedSave is a save with its LivelyMap data pulled out in
+// memory. Nothing is written until commit is called.
+type extractedSave struct {
+	path     string
+	original []byte
+	// records are the save's records without the LivelyMap data.
+	records []*esm.Record
+	header  *SaveHeader
+	data    *SaveData
+}
+
+// readSave reads a save and pulls out its LivelyMap data, without
+// changing the save.
+func readSave(savePath string) (*extractedSave, error) {
+	original, err := os.ReadFile(savePath)
+	if err != nil {
+		return nil, fmt.Errorf("read %q: %w", savePath, err)
 	}
-	records, err := esm.ParsePluginData("savefile", src)
+	records, err := esm.ParsePluginData("savefile", bytes.NewReader(original))
 	if err != nil {
 		return nil, fmt.Errorf("parse %q: %w", savePath, err)
 	}
+	header, err := parseHeader(records)
+	if err != nil {
+		return nil, fmt.Errorf("read header of %q: %w", savePath, err)
+	}
 	// find the data we are interested in
 	// as a side-effect, records will be mutated to drop the records.
 	raw, err := extractRecord(records)
@@ -132,56 +171,202 @@ func ExtractData(savePath string) (*SaveData, error) {
 	if err != nil {
 		return nil, fmt.Errorf("unmarshal extracted data from %q: %w", savePath, err)
 	}
-	// overwrite the file with one that has the data removed.
-	if err := src.Truncate(0); err != nil {
-		return nil, fmt.Errorf("truncate save file: %w", err)
+	return &extractedSave{
+		path:     savePath,
+		original: original,
+		records:  records,
+		header:   header,
+		data:     data,
+	}, nil
+}
+
+// rewrittenSize is the size the save will be once the LivelyMap data
+// is removed from it.
+func (s *extractedSave) rewrittenSize() (int, error) {
+	buf := &bytes.Buffer{}
+	if err := esm.WriteRecords(buf, slices.Values(s.records)); err != nil {
+		return 0, fmt.Errorf("write records of %q: %w", s.path, err)
 	}
-	if _, err := src.Seek(0, io.SeekStart); err != nil {
-		return nil, fmt.Errorf("seek save file: %w", err)
+	return buf.Len(), nil
+}
+
+// commit backs up the save and replaces it with one that has the
+// LivelyMap data removed.
+func (s *extractedSave) commit(backups int) error {
+	if _, err := backupSave(s.path, s.original, time.Now(), backups); err != nil {
+		return err
 	}
-	if err := esm.WriteRecords(src, slices.Values(records)); err != nil {
-		return nil, fmt.Errorf("rewrite save file %q: %w", savePath, err)
+	if err := replaceFile(s.path, func(w io.Writer) error {
+		return esm.WriteRecords(w, slices.Values(s.records))
+	}, func(written []byte, rewritten []*esm.Record) error {
+		if _, err := extractRecord(rewritten); !errors.Is(err, ErrNoData) {
+			return fmt.Errorf("still has LivelyMap data")
+		}
+		return verifyRewrite(s.original, written)
+	}); err != nil {
+		return fmt.Errorf("rewrite save file %q: %w", s.path, err)
 	}
+	return nil
+}
 
-	return data, nil
+// ErrNoData is returned for saves without LivelyMap data, which
+// includes saves that have already been extracted.
+var ErrNoData = errors.New("didn't find any data")
+
+// PLAY is the save record that holds the player's Lua script data.
+const PLAY = esm.RecordTag("PLAY")
+
+// playerScript is the script that stores LivelyMap data in the save.
+const playerScript = "scripts/livelymap/player.lua"
+
+// livelyMapScript finds the LUAS subrecord for the LivelyMap player
+// script in rec. Its LUAD is the next subrecord. If rec doesn't have
+// one, it returns -1.
+func livelyMapScript(rec *esm.Record) (int, error) {
+	if rec.Tag != PLAY {
+		return -1, nil
+	}
+	for i, sub := range rec.Subrecords {
+		if sub.Tag != lua.LUAS {
+			continue
+		}
+		lf := lua.LUASField{}
+		if err := lf.Unmarshal(sub); err != nil {
+			return -1, fmt.Errorf("parse LUAS subrecord: %w", err)
+		}
+		if lf.Value != playerScript {
+			continue
+		}
+		// the next record should be LUAD
+		if i+1 >= len(rec.Subrecords) || rec.Subrecords[i+1].Tag != lua.LUAD {
+			return -1, fmt.Errorf("expected LUAD after LUAS")
+		}
+		return i, nil
+	}
+	return -1, nil
 }
 
 func extractRecord(records []*esm.Record) ([]byte, error) {
-	var found []byte
 	for _, rec := range records {
 		// there's only one LUAM per save game
-		if rec.Tag != esm.RecordTag("PLAY") {
+		i, err := livelyMapScript(rec)
+		if err != nil {
+			return nil, err
+		}
+		if i < 0 {
 			continue
 		}
-		for i := 0; i < len(rec.Subrecords); i++ {
-			sub := rec.Subrecords[i]
-			if sub.Tag == lua.LUAS {
-				lf := lua.LUASField{}
-				if err := lf.Unmarshal(sub); err != nil {
-					return nil, fmt.Errorf("parse LUAS subrecord: %w", err)
+		// Extract our JSON data from it.
+		found, err := extractBetween(
+			bytes.NewReader(rec.Subrecords[i+1].Data),
+			[]byte(magic_prefix),
+			[]byte(magic_suffix))
+		if err != nil {
+			return nil, fmt.Errorf("read JSON in LUAD: %w", err)
+		}
+		// Snip the current record and next one.
+		rec.Subrecords = append(rec.Subrecords[:i], rec.Subrecords[i+2:]...)
+		return found, nil
+	}
+	return nil, ErrNoData
+}
+
+// recordHeaderLen is the size of a record's tag, size, and flags.
+// subrecordHeaderLen is the size of a subrecord's tag and size.
+const (
+	recordHeaderLen    = 16
+	subrecordHeaderLen = 8
+)
+
+// rawRecords splits a save into the bytes of each of its records,
+// without parsing them.
+func rawRecords(data []byte) ([][]byte, error) {
+	out := [][]byte{}
+	for len(data) > 0 {
+		if len(data) < recordHeaderLen {
+			return nil, fmt.Errorf("record %d is cut off", len(out))
+		}
+		end := recordHeaderLen + int(binary.LittleEndian.Uint32(data[4:8]))
+		if end > len(data) {
+			return nil, fmt.Errorf("record %d (%s) is cut off", len(out), data[:4])
+		}
+		out = append(out, data[:end])
+		data = data[end:]
+	}
+	return out, nil
+}
+
+// withoutScript is a raw record without its size or any LivelyMap
+// script data. Those are all that extracting or injecting can change.
+func withoutScript(raw []byte) ([]byte, error) {
+	out := slices.Concat(raw[:4], raw[8:recordHeaderLen])
+	subs := raw[recordHeaderLen:]
+	for len(subs) > 0 {
+		if len(subs) < subrecordHeaderLen {
+			return nil, fmt.Errorf("subrecord is cut off")
+		}
+		end := subrecordHeaderLen + int(binary.LittleEndian.Uint32(subs[4:8]))
+		if end > len(subs) {
+			return nil, fmt.Errorf("subrecord %s is cut off", subs[:4])
+		}
+		sub, next := subs[:end], subs[end:]
+		if esm.SubrecordTag(sub[:4]) == lua.LUAS {
+			lf := lua.LUASField{}
+			if err := lf.Unmarshal(&esm.Subrecord{Tag: lua.LUAS, Data: sub[subrecordHeaderLen:]}); err != nil {
+				return nil, fmt.Errorf("parse LUAS subrecord: %w", err)
+			}
+			if lf.Value == playerScript {
+				// Skip it and its LUAD.
+				if len(next) < subrecordHeaderLen || esm.SubrecordTag(next[:4]) != lua.LUAD {
+					return nil, fmt.Errorf("expected LUAD after LUAS")
 				}
-				if lf.Value == "scripts/livelymap/player.lua" {
-					// the next record should be LUAD
-					if rec.Subrecords[i+1].Tag != lua.LUAD {
-						return nil, fmt.Errorf("expected LUAD after LUAS")
-					}
-					// Extract our JSON data from it.
-					var err error
-					found, err = extractBetween(
-						bytes.NewReader(rec.Subrecords[i+1].Data),
-						[]byte(magic_prefix),
-						[]byte(magic_suffix))
-					if err != nil {
-						return nil, fmt.Errorf("read JSON in LUAD: %w", err)
-					}
-					// Snip the current record and next one.
-					rec.Subrecords = append(rec.Subrecords[:i], rec.Subrecords[i+2:]...)
-					return found, nil
+				luadEnd := subrecordHeaderLen + int(binary.LittleEndian.Uint32(next[4:8]))
+				if luadEnd > len(next) {
+					return nil, fmt.Errorf("subrecord LUAD is cut off")
 				}
+				subs = next[luadEnd:]
+				continue
 			}
 		}
+		out = append(out, sub...)
+		subs = next
 	}
-	return nil, fmt.Errorf("didn't find any data")
+	return out, nil
+}
+
+// verifyRewrite checks that the only difference between a save's
+// bytes before and after it was rewritten is the LivelyMap script
+// data. Every other record has to be byte for byte what it was in the
+// original file.
+func verifyRewrite(original, rewritten []byte) error {
+	before, err := rawRecords(original)
+	if err != nil {
+		return fmt.Errorf("split original: %w", err)
+	}
+	after, err := rawRecords(rewritten)
+	if err != nil {
+		return fmt.Errorf("split rewritten: %w", err)
+	}
+	if len(before) != len(after) {
+		return fmt.Errorf("had %d records, but now has %d", len(before), len(after))
+	}
+	for i := range before {
+		if bytes.Equal(before[i], after[i]) {
+			continue
+		}
+		want, err := withoutScript(before[i])
+		if err != nil {
+			return fmt.Errorf("record %d (%s): %w", i, before[i][:4], err)
+		}
+		got, err := withoutScript(after[i])
+		if err != nil {
+			return fmt.Errorf("record %d (%s): %w", i, after[i][:4], err)
+		}
+		if !bytes.Equal(want, got) {
+			return fmt.Errorf("record %d (%s) changed", i, before[i][:4])
+		}
+	}
+	return nil
 }
 
 func Unmarshal(raw []byte) (*SaveData, error) {
@@ -32,7 +32,7 @@ func TestOpenMwCfg(t *testing.T) {
 	initialSaveData, err := os.ReadFile(saveFile)
 	require.NoError(t, err)
 
-	saveData, err := ExtractData(saveFile)
+	saveData, err := ExtractData(saveFile, DefaultBackups)
 	require.NoError(t, err)
 	require.NotNil(t, saveData)
 	require.NotEmpty(t, saveData.Paths)
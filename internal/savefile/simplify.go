@@ -0,0 +1,200 @@
+package savefile
+
+import (
+	"math"
+	"strings"
+)
+
+// TeleportDistance is how far apart two entries in a row have to be
+// to be a teleport or a trip, rather than a walk. The player script
+// adds an entry every third of a cell.
+const TeleportDistance = 2 * cellUnits
+
+// maxSpeed is faster than the player can go on their own, in world
+// units per game second. At the default time scale of 30, it's 1500
+// units per real second.
+const maxSpeed = 50
+
+// teleported is whether the player teleported or traveled between two
+// entries in a row. Entries that haven't been through extraction
+// aren't marked, so for those it has to be a jump of more than
+// TeleportDistance that's too quick to have been walked. A simplified
+// path can have walks that long, but not that quick. Entries without a
+// position are never teleports.
+func teleported(prev, next *PathEntry) bool {
+	if !hasPosition(prev) || !hasPosition(next) {
+		return false
+	}
+	if next.Teleport {
+		return true
+	}
+	d := distance(prev, next)
+	return d > TeleportDistance && d > float64(next.TimeStamp-min(prev.TimeStamp, next.TimeStamp))*maxSpeed
+}
+
+// markTeleports sets Teleport on the entries of paths that come right
+// after a jump of more than TeleportDistance. It only looks at the
+// entries whose times aren't in old, since they haven't been
+// simplified yet, so any jump that long is a teleport or a trip.
+func markTeleports(paths []*PathEntry, old map[uint64]bool) {
+	for i := 1; i < len(paths); i++ {
+		prev, entry := paths[i-1], paths[i]
+		if old[entry.TimeStamp] || !hasPosition(prev) || !hasPosition(entry) {
+			continue
+		}
+		if distance(prev, entry) > TeleportDistance {
+			entry.Teleport = true
+		}
+	}
+}
+
+// SimplifyOptions controls Simplify. The zero value keeps everything.
+type SimplifyOptions struct {
+	// MinDistance drops entries that are this close to the last entry
+	// kept, in world units, which is where the player stood still.
+	MinDistance float64
+	// Tolerance is how far, in world units, the simplified path can
+	// stray from the original one.
+	Tolerance float64
+	// MinTimeGap drops entries that are less than this many game
+	// seconds after the last entry kept.
+	MinTimeGap uint64
+}
+
+// slack is how far an entry of an unsimplified path can be from a
+// simplified copy of it.
+func (o SimplifyOptions) slack() float64 {
+	return max(o.MinDistance, o.Tolerance)
+}
+
+func distance(a, b *PathEntry) float64 {
+	return math.Sqrt((a.Xposition-b.Xposition)*(a.Xposition-b.Xposition) +
+		(a.Yposition-b.Yposition)*(a.Yposition-b.Yposition) +
+		(a.Zposition-b.Zposition)*(a.Zposition-b.Zposition))
+}
+
+// segmentDistance is the distance from p to the line segment from a
+// to b.
+func segmentDistance(p, a, b *PathEntry) float64 {
+	dx, dy, dz := b.Xposition-a.Xposition, b.Yposition-a.Yposition, b.Zposition-a.Zposition
+	length2 := dx*dx + dy*dy + dz*dz
+	if length2 == 0 {
+		return distance(p, a)
+	}
+	f := ((p.Xposition-a.Xposition)*dx + (p.Yposition-a.Yposition)*dy + (p.Zposition-a.Zposition)*dz) / length2
+	f = min(max(f, 0), 1)
+	return distance(p, &PathEntry{
+		Xposition: a.Xposition + f*dx,
+		Yposition: a.Yposition + f*dy,
+		Zposition: a.Zposition + f*dz,
+	})
+}
+
+// pinned marks the entries that simplification can't remove: the
+// first and last ones, the ones in interiors, and the ones on either
+// side of going in or out of an interior or of a teleport.
+func pinned(paths []*PathEntry) []bool {
+	pin := make([]bool, len(paths))
+	for i, entry := range paths {
+		if len(entry.Cell) > 0 {
+			pin[i] = true
+		}
+		if i == 0 {
+			continue
+		}
+		prev := paths[i-1]
+		if !strings.EqualFold(prev.Cell, entry.Cell) || teleported(prev, entry) {
+			pin[i-1] = true
+			pin[i] = true
+		}
+	}
+	if len(paths) > 0 {
+		pin[0] = true
+		pin[len(paths)-1] = true
+	}
+	return pin
+}
+
+// douglasPeucker marks which of paths to keep so that the rest are
+// no farther than tolerance from the line through the kept ones. The
+// ends are always kept.
+func douglasPeucker(paths []*PathEntry, tolerance float64, keep []bool) {
+	keep[0] = true
+	keep[len(paths)-1] = true
+	if len(paths) < 3 {
+		return
+	}
+	farthest, farthestDistance := 0, 0.0
+	for i := 1; i < len(paths)-1; i++ {
+		if d := segmentDistance(paths[i], paths[0], paths[len(paths)-1]); d > farthestDistance {
+			farthest, farthestDistance = i, d
+		}
+	}
+	if farthestDistance <= tolerance {
+		return
+	}
+	douglasPeucker(paths[:farthest+1], tolerance, keep[:farthest+1])
+	douglasPeucker(paths[farthest:], tolerance, keep[farthest:])
+}
+
+// Simplify drops entries from paths that don't change its shape much.
+// Interior entries, and the entries where the player went in or out
+// of an interior or teleported, are always kept.
+func Simplify(paths []*PathEntry, opts SimplifyOptions) []*PathEntry {
+	return simplifyNew(paths, nil, opts)
+}
+
+// simplifyNew is Simplify, but the entries whose times are in old are
+// kept too. Those have already been simplified, and simplifying them
+// again would let the path stray further than opts.Tolerance from
+// where the player actually went.
+func simplifyNew(paths []*PathEntry, old map[uint64]bool, opts SimplifyOptions) []*PathEntry {
+	if len(paths) < 3 {
+		return paths
+	}
+	pin := pinned(paths)
+	for i, entry := range paths {
+		if old[entry.TimeStamp] {
+			pin[i] = true
+		}
+	}
+
+	// Drop the entries that are too close to the last one, in space
+	// or in time.
+	kept := []*PathEntry{}
+	keptPins := []bool{}
+	for i, entry := range paths {
+		if !pin[i] && len(kept) > 0 {
+			last := kept[len(kept)-1]
+			if opts.MinDistance > 0 && distance(last, entry) <= opts.MinDistance {
+				continue
+			}
+			if opts.MinTimeGap > 0 && entry.TimeStamp < last.TimeStamp+opts.MinTimeGap {
+				continue
+			}
+		}
+		kept = append(kept, entry)
+		keptPins = append(keptPins, pin[i])
+	}
+	if opts.Tolerance <= 0 {
+		return kept
+	}
+
+	// Simplify the runs between pinned entries on their own, so
+	// lines are never drawn through a teleport.
+	keep := make([]bool, len(kept))
+	start := 0
+	for i := 1; i < len(kept); i++ {
+		if keptPins[i] {
+			douglasPeucker(kept[start:i+1], opts.Tolerance, keep[start:i+1])
+			start = i
+		}
+	}
+	out := make([]*PathEntry, 0, len(kept))
+	for i, entry := range kept {
+		if keep[i] {
+			out = append(out, entry)
+		}
+	}
+	return out
+}
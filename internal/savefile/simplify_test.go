@@ -0,0 +1,132 @@
+package savefile
+
+import (
+	"math"
+	"slices"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func at(t uint64, x, y float64) *PathEntry {
+	return &PathEntry{TimeStamp: t, Xposition: x, Yposition: y}
+}
+
+func TestSimplify(t *testing.T) {
+	// A straight walk east with a wobble, a stop, and then a teleport.
+	paths := []*PathEntry{
+		at(1, 0, 0),
+		at(2, 1000, 10),
+		at(3, 2000, 0),
+		at(4, 2000, 0),
+		at(5, 2005, 0),
+		at(6, 3000, -10),
+		at(7, 4000, 0),
+		at(8, 100000, 0),
+		at(9, 101000, 0),
+	}
+
+	// The zero value keeps everything.
+	require.Equal(t, paths, Simplify(paths, SimplifyOptions{}))
+
+	require.Equal(t, []uint64{1, 2, 3, 6, 7, 8, 9}, times(Simplify(paths, SimplifyOptions{MinDistance: 10})))
+	require.Equal(t, []uint64{1, 3, 5, 7, 8, 9}, times(Simplify(paths, SimplifyOptions{MinTimeGap: 2})))
+
+	// Both sides of the teleport are kept, so no line crosses it.
+	require.Equal(t, []uint64{1, 7, 8, 9}, times(Simplify(paths, SimplifyOptions{Tolerance: 50})))
+	require.Equal(t, []uint64{1, 2, 6, 7, 8, 9}, times(Simplify(paths, SimplifyOptions{Tolerance: 5})))
+
+	// Going in and out of interiors is kept too.
+	inside := []*PathEntry{
+		at(1, 0, 0),
+		at(2, 1000, 0),
+		{TimeStamp: 3, Xposition: 2000, Cell: "Seyda Neen, Arrille's Tradehouse"},
+		{TimeStamp: 4, Xposition: 2000, Cell: "Seyda Neen, Arrille's Tradehouse"},
+		at(5, 2000, 0),
+		at(6, 3000, 0),
+		at(7, 4000, 0),
+	}
+	require.Equal(t, []uint64{1, 2, 3, 4, 5, 7}, times(Simplify(inside, SimplifyOptions{Tolerance: 50, MinDistance: 10})))
+}
+
+func TestSimplifySave(t *testing.T) {
+	// The test save goes in and out of an office twice.
+	save, err := readSave(saveFile)
+	require.NoError(t, err)
+	paths := save.data.Paths
+	require.Equal(t, 2, countInteriors(paths))
+
+	// Every entry is a transition, so none can go.
+	simplified := Simplify(paths, SimplifyOptions{MinDistance: cellUnits, Tolerance: cellUnits, MinTimeGap: 86400})
+	require.Equal(t, paths, simplified)
+}
+
+// countInteriors is the number of entries for interior visits.
+func countInteriors(paths []*PathEntry) int {
+	n := 0
+	for _, entry := range paths {
+		if len(entry.Cell) > 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// simplifyError is how far the farthest of paths is from the line
+// through simplified.
+func simplifyError(paths, simplified []*PathEntry) float64 {
+	worst := 0.0
+	for _, entry := range paths {
+		nearest := math.Inf(1)
+		for i := 1; i < len(simplified); i++ {
+			nearest = min(nearest, segmentDistance(entry, simplified[i-1], simplified[i]))
+		}
+		worst = max(worst, nearest)
+	}
+	return worst
+}
+
+func TestSimplifyNew(t *testing.T) {
+	opts := SimplifyOptions{Tolerance: 100}
+	// The first extraction drops the dip, since it's close enough to
+	// the line to the last entry.
+	first := []*PathEntry{at(1, 0, 0), at(2, 500, -90), at(3, 1000, 0)}
+	simplified := Simplify(first, opts)
+	require.Equal(t, []uint64{1, 3}, times(simplified))
+
+	// The next one climbs, and the line to it passes close enough to
+	// the last entry to drop that too, but not the dip before it.
+	paths := append(slices.Clone(first), at(4, 2000, 180))
+	next := append(slices.Clone(simplified), paths[3])
+	require.Greater(t, simplifyError(paths, Simplify(next, opts)), opts.Tolerance)
+
+	// Leaving the first extraction alone keeps it within tolerance.
+	kept := simplifyNew(next, timeStamps(simplified), opts)
+	require.Equal(t, []uint64{1, 3, 4}, times(kept))
+	require.LessOrEqual(t, simplifyError(paths, kept), opts.Tolerance)
+}
+
+func TestTeleported(t *testing.T) {
+	start := at(1000, 100, 100)
+	// Recall is instant.
+	require.True(t, teleported(start, at(1001, 10*cellUnits, 0)))
+	// A simplified walk can be long, but it takes a while.
+	require.False(t, teleported(start, at(5000, 3*cellUnits, 0)))
+	// A trip by silt strider takes a while too, so it has to be marked.
+	strider := at(20000, 6*cellUnits, 0)
+	require.False(t, teleported(start, strider))
+	strider.Teleport = true
+	require.True(t, teleported(start, strider))
+	// Older interior entries don't have a position.
+	require.False(t, teleported(at(900, 5*cellUnits, 0), &PathEntry{TimeStamp: 1000, Cell: "Some House"}))
+
+	paths := []*PathEntry{at(1, 100, 100), at(2, 1000, 100), at(5000, 10*cellUnits, 0), at(5001, 10*cellUnits+1000, 0)}
+	markTeleports(paths, nil)
+	require.Equal(t, []bool{false, false, true, false}, []bool{paths[0].Teleport, paths[1].Teleport, paths[2].Teleport, paths[3].Teleport})
+
+	// Entries that are already in the path file might have been
+	// simplified, so they aren't marked.
+	old := []*PathEntry{at(1, 100, 100), at(2, 3*cellUnits, 100)}
+	markTeleports(old, timeStamps(old))
+	require.False(t, old[1].Teleport)
+}
@@ -0,0 +1,161 @@
+package savefile
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"slices"
+)
+
+// Trip is a stretch of a path with no teleports or interiors in it.
+type Trip struct {
+	From     uint64
+	To       uint64
+	Distance float64
+}
+
+// JourneyStats summarizes a character's paths.
+type JourneyStats struct {
+	Character string
+	Entries   int
+	// FirstTime and LastTime are the game times of the first and last
+	// entries.
+	FirstTime uint64
+	LastTime  uint64
+	// Distance is how far the character went in the exterior world,
+	// not counting teleports, in world units. DistanceCells is the
+	// same, in cells.
+	Distance      float64
+	DistanceCells float64
+	// Cells is the number of distinct exterior cells visited, and
+	// Interiors is the number of distinct interior cells.
+	Cells     int
+	Interiors int
+	Teleports int
+	// LongestTrip is the longest stretch without a teleport or an
+	// interior.
+	LongestTrip *Trip `json:",omitempty"`
+	// Regions and Submaps are the game seconds spent in each, keyed by
+	// region name and submap ID. They're empty without maps.json.
+	Regions map[string]uint64
+	Submaps map[string]uint64
+}
+
+// unknownArea is the region or submap of places that aren't in one.
+const unknownArea = "unknown"
+
+// cellOf is the exterior cell a path entry is in.
+func cellOf(entry *PathEntry) (int32, int32) {
+	return int32(math.Floor(entry.Xposition / cellUnits)), int32(math.Floor(entry.Yposition / cellUnits))
+}
+
+// area is the region and submap a cell is in.
+func (m *mapInfo) area(x, y int32) (string, string) {
+	region, submap := unknownArea, unknownArea
+	if id, ok := m.CellRegions[fmt.Sprintf("%d,%d", x, y)]; ok {
+		region = id
+		if info, ok := m.Regions[id]; ok && len(info.Name) > 0 {
+			region = info.Name
+		}
+	}
+	ids := []string{}
+	for id := range m.Maps {
+		ids = append(ids, id)
+	}
+	slices.Sort(ids)
+	for _, id := range ids {
+		e := m.Maps[id].Extents
+		if x >= e.Left && x <= e.Right && y >= e.Bottom && y <= e.Top {
+			submap = id
+			break
+		}
+	}
+	return region, submap
+}
+
+// Stats sums up a character's paths. info can be nil, and then time
+// isn't split up by region or submap.
+func Stats(data *SaveData, info *mapInfo) *JourneyStats {
+	out := &JourneyStats{
+		Character: data.Player,
+		Entries:   len(data.Paths),
+		Regions:   map[string]uint64{},
+		Submaps:   map[string]uint64{},
+	}
+	if len(data.Paths) == 0 {
+		return out
+	}
+	out.FirstTime = data.Paths[0].TimeStamp
+	out.LastTime = data.Paths[len(data.Paths)-1].TimeStamp
+
+	cells := map[[2]int32]bool{}
+	interiors := map[string]bool{}
+	trip := &Trip{From: data.Paths[0].TimeStamp, To: data.Paths[0].TimeStamp}
+	endTrip := func() {
+		if trip.Distance > 0 && (out.LongestTrip == nil || trip.Distance > out.LongestTrip.Distance) {
+			out.LongestTrip = trip
+		}
+	}
+	// where is the last entry with a position. Time in interiors
+	// without one is spent where the player went in.
+	var where *PathEntry
+	for i, entry := range data.Paths {
+		if len(entry.Cell) > 0 {
+			interiors[entry.Cell] = true
+		} else {
+			x, y := cellOf(entry)
+			cells[[2]int32{x, y}] = true
+		}
+		if i+1 == len(data.Paths) {
+			break
+		}
+		next := data.Paths[i+1]
+		if hasPosition(entry) {
+			where = entry
+		}
+		if teleported(entry, next) {
+			// Time spent traveling isn't spent anywhere in particular.
+			out.Teleports++
+			endTrip()
+			trip = &Trip{From: next.TimeStamp, To: next.TimeStamp}
+			continue
+		}
+		if info != nil && next.TimeStamp > entry.TimeStamp && where != nil {
+			region, submap := info.area(cellOf(where))
+			out.Regions[region] += next.TimeStamp - entry.TimeStamp
+			out.Submaps[submap] += next.TimeStamp - entry.TimeStamp
+		}
+		if len(entry.Cell) > 0 || len(next.Cell) > 0 {
+			endTrip()
+			trip = &Trip{From: next.TimeStamp, To: next.TimeStamp}
+			continue
+		}
+		step := distance(entry, next)
+		out.Distance += step
+		trip.Distance += step
+		trip.To = next.TimeStamp
+	}
+	endTrip()
+	out.DistanceCells = out.Distance / cellUnits
+	out.Cells = len(cells)
+	out.Interiors = len(interiors)
+	return out
+}
+
+// CharacterStats reads a character's path file from the LivelyMap
+// install at rootPath and sums it up. If maps.json is missing, time
+// isn't split up by region or submap.
+func CharacterStats(rootPath string, character string) (*JourneyStats, error) {
+	data, err := ReadPathFile(rootPath, character)
+	if err != nil {
+		return nil, err
+	}
+	info, err := readMapInfo(filepath.Join(rootPath, MapsJSON))
+	if err != nil {
+		fmt.Printf("Not splitting time up by region: %v\n", err)
+		info = nil
+	}
+	stats := Stats(data, info)
+	stats.Character = character
+	return stats, nil
+}
@@ -0,0 +1,81 @@
+package savefile
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestStats(t *testing.T) {
+	info := &mapInfo{
+		Maps: map[string]struct{ Extents Extents }{
+			"1": {Extents: Extents{Top: 0, Bottom: -1, Left: 0, Right: 1}},
+			"2": {Extents: Extents{Top: 0, Bottom: -1, Left: 10, Right: 20}},
+		},
+		Regions:     map[string]struct{ Name string }{"bitter coast region": {Name: "Bitter Coast Region"}},
+		CellRegions: map[string]string{"0,0": "bitter coast region"},
+	}
+	data := &SaveData{Player: "p", Paths: []*PathEntry{
+		// A walk east across two cells.
+		at(100, 100, 100),
+		at(200, 4100, 100),
+		at(300, 8292, 100),
+		// A visit to an interior.
+		{TimeStamp: 400, Xposition: 8292, Yposition: 100, Cell: "Some House"},
+		at(1000, 8292, 100),
+		at(1100, 12292, 100),
+		// A teleport far to the east, and a short walk.
+		at(1200, 10*cellUnits+100, 100),
+		at(1300, 10*cellUnits+1100, 100),
+	}}
+
+	stats := Stats(data, info)
+	require.Equal(t, 8, stats.Entries)
+	require.Equal(t, uint64(100), stats.FirstTime)
+	require.Equal(t, uint64(1300), stats.LastTime)
+	require.InDelta(t, 8192+4000+1000, stats.Distance, 0.001)
+	require.InDelta(t, (8192+4000+1000)/8192.0, stats.DistanceCells, 0.001)
+	require.Equal(t, 3, stats.Cells)
+	require.Equal(t, 1, stats.Interiors)
+	require.Equal(t, 1, stats.Teleports)
+	require.Equal(t, &Trip{From: 100, To: 300, Distance: 8192}, stats.LongestTrip)
+
+	require.Equal(t, map[string]uint64{"Bitter Coast Region": 200, "unknown": 900}, stats.Regions)
+	// Time spent teleporting isn't counted.
+	require.Equal(t, map[string]uint64{"1": 1000, "2": 100}, stats.Submaps)
+
+	// Without map info, time isn't split up.
+	require.Empty(t, Stats(data, nil).Regions)
+}
+
+func TestStatsSave(t *testing.T) {
+	save, err := readSave(saveFile)
+	require.NoError(t, err)
+	stats := Stats(save.data, nil)
+	require.Equal(t, 5, stats.Entries)
+	require.Equal(t, 1, stats.Interiors)
+	require.Zero(t, stats.Teleports)
+}
+
+func TestStatsSimplified(t *testing.T) {
+	data := &SaveData{Player: "p", Paths: []*PathEntry{
+		at(100, 100, 100),
+		// A long walk that was simplified.
+		at(2000, 3*cellUnits+100, 100),
+		// An interior from an older player script, with no position.
+		{TimeStamp: 2100, Cell: "Some House"},
+		at(3000, 3*cellUnits+100, 100),
+		// A slow trip that extraction marked.
+		{TimeStamp: 10000, Xposition: 3*cellUnits + 100, Yposition: 5 * cellUnits, Teleport: true},
+	}}
+	stats := Stats(data, nil)
+	require.Equal(t, 1, stats.Teleports)
+	require.InDelta(t, 3*cellUnits, stats.Distance, 0.001)
+	require.Equal(t, &Trip{From: 100, To: 2000, Distance: 3 * cellUnits}, stats.LongestTrip)
+	require.Equal(t, 3, stats.Cells)
+	require.Equal(t, 1, stats.Interiors)
+
+	// Without the mark, it's too slow to be anything but a walk.
+	data.Paths[4].Teleport = false
+	require.Zero(t, Stats(data, nil).Teleports)
+}
@@ -2,21 +2,25 @@ package savefile
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/ernmw/omwpacker/cfg"
 )
 
-func newestFileInFolder(path string, ext string) (fs.FileInfo, error) {
+// filesByAge lists the files in path with ext, newest first.
+func filesByAge(path string, ext string) ([]string, error) {
 	saveFiles, err := os.ReadDir(path)
 	if err != nil {
 		return nil, fmt.Errorf("read dirs in %q: %w", path, err)
 	}
-	var latestSave fs.FileInfo
+	infos := []fs.FileInfo{}
 	for _, saveFile := range saveFiles {
 		saveInfo, err := saveFile.Info()
 		if err != nil {
@@ -28,84 +32,352 @@ func newestFileInFolder(path string, ext string) (fs.FileInfo, error) {
 		if !strings.EqualFold(filepath.Ext(saveFile.Name()), ext) {
 			continue
 		}
-		if latestSave == nil || saveInfo.ModTime().After(latestSave.ModTime()) {
-			latestSave = saveInfo
-		}
+		infos = append(infos, saveInfo)
+	}
+	slices.SortStableFunc(infos, func(a, b fs.FileInfo) int {
+		return b.ModTime().Compare(a.ModTime())
+	})
+	out := make([]string, 0, len(infos))
+	for _, info := range infos {
+		out = append(out, filepath.Join(path, info.Name()))
 	}
-	return latestSave, nil
+	return out, nil
 }
 
-func extractFromCharacter(rootPath string, saveDir string) error {
-	entries, err := os.ReadDir(saveDir)
+// PathsDir is where extracted path data is kept, relative to the
+// mod root.
+var PathsDir = filepath.Join("00 Core", "scripts", "LivelyMap", "data", "paths")
+
+// ReadPathFile reads a character's extracted path data. character is
+// the name of the path file, without ".json".
+func ReadPathFile(rootPath string, character string) (*SaveData, error) {
+	pathFile := filepath.Join(rootPath, PathsDir, character+".json")
+	raw, err := os.ReadFile(pathFile)
+	if err != nil {
+		return nil, fmt.Errorf("read path file for %q: %w", character, err)
+	}
+	data, err := Unmarshal(raw)
 	if err != nil {
-		return fmt.Errorf("read dirs in %q: %w", saveDir, err)
+		return nil, fmt.Errorf("bad path data in %q: %w", pathFile, err)
+	}
+	return data, nil
+}
+
+// ExtractReport describes what extracting a character's saves did, or
+// would do in a dry run.
+type ExtractReport struct {
+	Character string
+	// Save is the newest save that was extracted.
+	Save     string
+	PathFile string
+	// Saves is the number of saves extracted.
+	Saves int
+	// Added is the number of entries from the save that weren't
+	// already in the path file.
+	Added int
+	// Dropped is the number of entries in the path file that the save
+	// replaced.
+	Dropped int
+	// Simplified is the number of entries that simplification removed.
+	Simplified int
+	// Entries is the number of entries in the merged path data.
+	Entries int
+	// Branches is the number of archived timelines in the path file.
+	Branches int
+	// FirstTime and LastTime are the game times of the first and
+	// last merged entries.
+	FirstTime uint64
+	LastTime  uint64
+	// JSONBytes is the size of the merged path file.
+	JSONBytes int
+	// SaveBytesRemoved is how much smaller the saves are without
+	// the path data.
+	SaveBytesRemoved int
+	// ContentMismatch is how the newest save's content files differ
+	// from openmw.cfg's, if they do.
+	ContentMismatch string
+}
+
+// timeStamps is the set of the times of entries.
+func timeStamps(entries []*PathEntry) map[uint64]bool {
+	out := map[uint64]bool{}
+	for _, entry := range entries {
+		out[entry.TimeStamp] = true
 	}
+	return out
+}
+
+// countMissing is the number of entries whose times aren't in others.
+func countMissing(entries []*PathEntry, others map[uint64]bool) int {
+	n := 0
 	for _, entry := range entries {
-		if !entry.IsDir() {
+		if !others[entry.TimeStamp] {
+			n++
+		}
+	}
+	return n
+}
+
+// extractCharacter merges the path data in a character's saves into
+// their path file. The newest save's timeline is the main one. Older
+// saves are only read if opts.AllSaves is set. It returns nil if
+// there was nothing to extract, or if the newest save was written too
+// recently to touch.
+//
+// If loadOrder is set, saves made with different content files are
+// warned about, since their paths might not match the map.
+func extractCharacter(rootPath string, characterDir string, loadOrder []string, opts ExtractOptions) (*ExtractReport, error) {
+	saves, err := filesByAge(characterDir, ".omwsave")
+	if err != nil {
+		return nil, fmt.Errorf("list saves: %w", err)
+	}
+	if len(saves) == 0 {
+		return nil, nil
+	}
+	if !opts.AllSaves {
+		saves = saves[:1]
+	}
+	// have we already dumped this character?
+	dumpPath := filepath.Join(rootPath, PathsDir, fmt.Sprintf("%s.json", filepath.Base(characterDir)))
+	var parsedExistingData *SaveData
+	{
+		existingData, _ := os.ReadFile(dumpPath) // drop error
+		if len(existingData) > 0 {
+			parsedExistingData, err = Unmarshal(existingData)
+			if err != nil {
+				return nil, fmt.Errorf("bad path data in %q: %w", dumpPath, err)
+			}
+		}
+	}
+
+	newData := parsedExistingData
+	branches := []*Branch{}
+	if parsedExistingData != nil {
+		branches = parsedExistingData.Branches
+	}
+	extracted := []*extractedSave{}
+	for i, saveFileName := range saves {
+		if !opts.DryRun {
+			reason, err := waitFor(opts.Wait, func() (string, error) {
+				return saveBusy(saveFileName, opts.Grace, time.Now())
+			})
+			if err != nil {
+				return nil, err
+			}
+			if len(reason) > 0 && i == 0 {
+				fmt.Printf("Skipping %q because %s.\n", filepath.Base(characterDir), reason)
+				return nil, nil
+			}
+			if len(reason) > 0 {
+				fmt.Printf("Skipping %q because %s.\n", saveFileName, reason)
+				continue
+			}
+		}
+		save, err := readSave(saveFileName)
+		if errors.Is(err, ErrNoData) && opts.AllSaves {
+			// this one's already been extracted.
 			continue
 		}
-		characterDir := filepath.Join(saveDir, entry.Name())
-		newestSave, err := newestFileInFolder(characterDir, ".omwsave")
-		if err != nil {
-			return fmt.Errorf("newest file in folder: %w", err)
+		if err != nil && i == 0 {
+			return nil, err
 		}
-		if newestSave == nil {
+		if err != nil {
+			fmt.Printf("Skipping %q: %v\n", saveFileName, err)
 			continue
 		}
-		// have we already dumped this character?
-		dumpPath := filepath.Join(rootPath,
-			"00 Core",
-			"scripts",
-			"LivelyMap",
-			"data",
-			"paths",
-			fmt.Sprintf("%s.json", entry.Name()))
-		var parsedExistingData *SaveData
-		{
-			existingData, _ := os.ReadFile(dumpPath) // drop error
-			if len(existingData) > 0 {
-				parsedExistingData, err = Unmarshal(existingData)
-				if err != nil {
-					return fmt.Errorf("bad path data in %q: %w", dumpPath, err)
+
+		if i == 0 || newData == nil {
+			merged, err := Merge(newData, save.data)
+			if err != nil {
+				return nil, fmt.Errorf("merge %q and %q: %w", dumpPath, saveFileName, err)
+			}
+			if newData != nil && newData == parsedExistingData {
+				// If the player reloaded an older save and played on,
+				// the path file's entries after the reload are cut off.
+				if _, branch := reconcile(merged, parsedExistingData, opts.Simplify.slack()); branch != nil {
+					if !opts.Branches {
+						fmt.Printf("Not extracting %q: the path of %q splits from %q's at %d, and extracting it would throw away %d entries after that. Archive them with -branches.\n",
+							filepath.Base(characterDir), saveFileName, dumpPath, branch.Fork, len(branch.Paths))
+						return nil, nil
+					}
+					branch.Save = filepath.Base(dumpPath)
+					branches = addBranch(branches, branch)
 				}
 			}
+			newData = merged
+			extracted = append(extracted, save)
+			continue
 		}
-
-		// this next call will edit the save file
-		newestSaveFileName := filepath.Join(characterDir, newestSave.Name())
-		data, err := ExtractData(newestSaveFileName)
-		if err != nil {
-			// no data to extract.
-			fmt.Printf("extract save data in %q: %v\n", newestSaveFileName, err)
+		if !strings.EqualFold(newData.Player, save.data.Player) {
+			fmt.Printf("Skipping %q: it's for %q, not %q.\n", saveFileName, save.data.Player, newData.Player)
 			continue
 		}
-		newData, err := Merge(parsedExistingData, data)
+		var branch *Branch
+		newData, branch = reconcile(newData, save.data, opts.Simplify.slack())
+		if branch != nil {
+			if !opts.Branches {
+				// Extracting would lose this timeline.
+				fmt.Printf("Leaving %q alone because its path splits from the newest save's at %d. Archive it with -branches.\n", saveFileName, branch.Fork)
+				continue
+			}
+			branch.Save = filepath.Base(saveFileName)
+			branches = addBranch(branches, branch)
+		}
+		extracted = append(extracted, save)
+	}
+	if len(extracted) == 0 {
+		return nil, nil
+	}
+	// Merge can hand back one of its arguments, so this doesn't write
+	// to it.
+	newData = &SaveData{
+		Player:   newData.Player,
+		Paths:    newData.Paths,
+		Branches: branches,
+		Header:   extracted[0].header,
+		Extra:    newData.Extra,
+	}
+	if err := Validate(newData); err != nil {
+		return nil, fmt.Errorf("validate merged data: %w", err)
+	}
+	existing := []*PathEntry{}
+	if parsedExistingData != nil {
+		existing = parsedExistingData.Paths
+	}
+	dropped := countMissing(existing, timeStamps(newData.Paths))
+	merged := len(newData.Paths)
+	// Only the entries that are new to the path file are simplified.
+	// Teleports are marked first, while they're easy to tell from
+	// walks.
+	markTeleports(newData.Paths, timeStamps(existing))
+	newData.Paths = simplifyNew(newData.Paths, timeStamps(existing), opts.Simplify)
+	marshalledNewData, err := json.Marshal(newData)
+	if err != nil {
+		return nil, fmt.Errorf("marshal merged data for %q: %w", dumpPath, err)
+	}
+
+	report := &ExtractReport{
+		Character: filepath.Base(characterDir),
+		Save:      extracted[0].path,
+		PathFile:  dumpPath,
+		Saves:     len(extracted),
+		Entries:   len(newData.Paths),
+		Branches:  len(newData.Branches),
+		JSONBytes: len(marshalledNewData),
+	}
+	for _, save := range extracted {
+		rewrittenSize, err := save.rewrittenSize()
 		if err != nil {
-			return fmt.Errorf("merge %q and %q: %w", dumpPath, newestSaveFileName, err)
+			return nil, err
+		}
+		report.SaveBytesRemoved += len(save.original) - rewrittenSize
+	}
+	report.Added = countMissing(newData.Paths, timeStamps(existing))
+	report.Dropped = dropped
+	report.Simplified = merged - len(newData.Paths)
+	if len(newData.Paths) > 0 {
+		report.FirstTime = newData.Paths[0].TimeStamp
+		report.LastTime = newData.Paths[len(newData.Paths)-1].TimeStamp
+	}
+	if len(loadOrder) > 0 {
+		report.ContentMismatch = newData.Header.ContentMismatch(loadOrder)
+		if len(report.ContentMismatch) > 0 {
+			fmt.Printf("Warning: %q was made with different content files than openmw.cfg has, so its paths might not line up with the map. %s.\n", extracted[0].path, report.ContentMismatch)
 		}
-		if err := Validate(newData); err != nil {
-			return fmt.Errorf("validate merged data: %w", err)
+	}
+	if opts.DryRun {
+		return report, nil
+	}
+
+	// The path data is written before the saves are changed, so it
+	// can't be lost if a rewrite fails.
+	if err := os.WriteFile(dumpPath, marshalledNewData, 0666); err != nil {
+		return nil, fmt.Errorf("persist path data for %q: %w", dumpPath, err)
+	}
+	for _, save := range extracted {
+		if err := save.commit(opts.Backups); err != nil {
+			return nil, err
 		}
-		marshalledNewData, err := json.Marshal(newData)
+		fmt.Printf("Extracted path data from %q to %q.\n", save.path, dumpPath)
+	}
+	return report, nil
+}
+
+func extractFromCharacters(rootPath string, saveDir string, loadOrder []string, opts ExtractOptions) ([]*ExtractReport, error) {
+	entries, err := os.ReadDir(saveDir)
+	if err != nil {
+		return nil, fmt.Errorf("read dirs in %q: %w", saveDir, err)
+	}
+	reports := []*ExtractReport{}
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		report, err := extractCharacter(rootPath, filepath.Join(saveDir, entry.Name()), loadOrder, opts)
 		if err != nil {
-			return fmt.Errorf("marshal merged data for %q: %w", dumpPath, err)
+			// no data to extract.
+			fmt.Printf("extract save data for %q: %v\n", entry.Name(), err)
+			continue
 		}
-		if err := os.WriteFile(dumpPath, marshalledNewData, 0666); err != nil {
-			return fmt.Errorf("persist path data for %q: %w", dumpPath, err)
+		if report != nil {
+			reports = append(reports, report)
 		}
-		fmt.Printf("Extracted path data from %q to %q.", newestSaveFileName, dumpPath)
 	}
-	return nil
+	return reports, nil
+}
+
+// ExtractOptions controls ExtractSaveData.
+type ExtractOptions struct {
+	// Backups is the number of backups kept for each save.
+	Backups int
+	// DryRun reports what would be extracted without changing any
+	// save or path file.
+	DryRun bool
+	// AllSaves extracts from all of a character's saves, not just the
+	// newest one.
+	AllSaves bool
+	// Branches archives the paths of older saves that are on a
+	// different timeline than the newest save. Without it, those
+	// saves are left alone.
+	Branches bool
+	// Simplify controls how much the merged paths are simplified.
+	// Entries that were already in the path file are left alone.
+	Simplify SimplifyOptions
+	// Grace is how long after a save was written before it can be
+	// changed.
+	Grace time.Duration
+	// Wait is how long to wait for OpenMW to close, or for a save's
+	// grace window to pass, before skipping it.
+	Wait time.Duration
 }
 
+// ExtractSaveData moves the path data out of each character's newest
+// save, or all of their saves if opts.AllSaves is set, and into their
+// path file.
 func ExtractSaveData(
 	rootPath string,
-	env *cfg.Environment) error {
+	env *cfg.Environment,
+	opts ExtractOptions) ([]*ExtractReport, error) {
+	reports := []*ExtractReport{}
+	if !opts.DryRun {
+		// OpenMW could write a save while we're changing it.
+		reason, err := waitFor(opts.Wait, gameBusy)
+		if err != nil {
+			return nil, err
+		}
+		if len(reason) > 0 {
+			fmt.Printf("Not extracting paths from saves because %s. Close it and try again, or set -wait.\n", reason)
+			return reports, nil
+		}
+	}
 	for _, userDir := range env.User {
 		saveDir := filepath.Join(userDir, "saves")
-		if err := extractFromCharacter(rootPath, saveDir); err != nil {
-			fmt.Printf("Failed to extract data from %q: %v", saveDir, err)
+		found, err := extractFromCharacters(rootPath, saveDir, env.Plugins, opts)
+		if err != nil {
+			fmt.Printf("Failed to extract data from %q: %v\n", saveDir, err)
+			continue
 		}
+		reports = append(reports, found...)
 	}
-	return nil
+	return reports, nil
 }
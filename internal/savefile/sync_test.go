@@ -1,6 +1,8 @@
 package savefile
 
 import (
+	"encoding/json"
+	"os"
 	"path/filepath"
 	"strings"
 	"testing"
@@ -22,6 +24,73 @@ func BenchmarkSaveExtraction(b *testing.B) {
 	}
 
 	for b.Loop() {
-		require.NoError(b, ExtractSaveData(rootPath, env))
+		_, err := ExtractSaveData(rootPath, env, ExtractOptions{Backups: DefaultBackups})
+		require.NoError(b, err)
 	}
 }
+
+func TestExtractCharacterDryRun(t *testing.T) {
+	root := t.TempDir()
+	characterDir := filepath.Join(t.TempDir(), "erintestcharacter")
+	require.NoError(t, os.MkdirAll(characterDir, 0777))
+	original, err := os.ReadFile(saveFile)
+	require.NoError(t, err)
+	savePath := filepath.Join(characterDir, "1.omwsave")
+	require.NoError(t, os.WriteFile(savePath, original, 0666))
+
+	fromSave, err := readSave(savePath)
+	require.NoError(t, err)
+	require.NotEmpty(t, fromSave.data.Paths)
+
+	// The path file has one entry from before the save's data starts,
+	// and one that the save has too.
+	first := fromSave.data.Paths[0].TimeStamp
+	shared := *fromSave.data.Paths[0]
+	existing, err := json.Marshal(&SaveData{
+		Player: fromSave.data.Player,
+		Paths: []*PathEntry{
+			{TimeStamp: first - 1},
+			&shared,
+		},
+	})
+	require.NoError(t, err)
+	pathsDir := filepath.Join(root, PathsDir)
+	require.NoError(t, os.MkdirAll(pathsDir, 0777))
+	pathFile := filepath.Join(pathsDir, "erintestcharacter.json")
+	require.NoError(t, os.WriteFile(pathFile, existing, 0666))
+
+	report, err := extractCharacter(root, characterDir, nil, ExtractOptions{DryRun: true})
+	require.NoError(t, err)
+	require.Equal(t, "erintestcharacter", report.Character)
+	require.Equal(t, len(fromSave.data.Paths)-1, report.Added)
+	require.Equal(t, 0, report.Dropped)
+	require.Equal(t, len(fromSave.data.Paths)+1, report.Entries)
+	require.Equal(t, first-1, report.FirstTime)
+	require.Greater(t, report.JSONBytes, len(existing))
+	require.Greater(t, report.SaveBytesRemoved, 0)
+
+	// Nothing was written.
+	current, err := os.ReadFile(savePath)
+	require.NoError(t, err)
+	require.Equal(t, original, current)
+	currentPaths, err := os.ReadFile(pathFile)
+	require.NoError(t, err)
+	require.Equal(t, existing, currentPaths)
+	entries, err := os.ReadDir(characterDir)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	// A real run writes what the dry run reported.
+	done, err := extractCharacter(root, characterDir, nil, ExtractOptions{Backups: 1})
+	require.NoError(t, err)
+	require.Equal(t, report, done)
+	written, err := os.ReadFile(pathFile)
+	require.NoError(t, err)
+	require.Len(t, written, report.JSONBytes)
+	withHeader, err := Unmarshal(written)
+	require.NoError(t, err)
+	require.Equal(t, "Seyda Neen", withHeader.Header.Cell)
+	rewritten, err := os.ReadFile(savePath)
+	require.NoError(t, err)
+	require.Len(t, rewritten, len(original)-report.SaveBytesRemoved)
+}